@@ -40,6 +40,10 @@ type Config struct {
 	// TLSConfig when listening for encrypted connections (gRPC, DNS-over-TLS).
 	TLSConfig *tls.Config
 
+	// TsigSecret is a map of TSIG key names to their base64 encoded secrets. Plugins set it
+	// to make the server verify TSIG signed requests and sign the replies.
+	TsigSecret map[string]string
+
 	// Plugin stack.
 	Plugin []plugin.Plugin
 
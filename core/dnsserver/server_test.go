@@ -2,7 +2,10 @@ package dnsserver
 
 import (
 	"context"
+	"encoding/base64"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/log"
@@ -93,3 +96,74 @@ func BenchmarkCoreServeDNS(b *testing.B) {
 		s.ServeDNS(ctx, w, m)
 	}
 }
+
+type tsigPlugin struct{}
+
+func (tp tsigPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, 300, time.Now().Unix())
+	} else {
+		m.Rcode = dns.RcodeNotAuth
+	}
+	w.WriteMsg(m)
+	return 0, nil
+}
+
+func (tp tsigPlugin) Name() string { return "tsigplugin" }
+
+func TestTsigSecret(t *testing.T) {
+	const key = "key."
+	secret := base64.StdEncoding.EncodeToString([]byte("secret"))
+
+	config := testConfig("dns", tsigPlugin{})
+	config.TsigSecret = map[string]string{key: secret}
+	other := testConfig("dns", testPlugin{})
+	other.Zone = "example.org."
+	s, err := NewServer("127.0.0.1:53", []*Config{config, other})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+	if s.tsigSecret[key] != secret {
+		t.Fatalf("Expected TSIG secret of the zone to be set in the server")
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	go s.ServePacket(pc)
+	defer s.Stop()
+
+	for _, tc := range []struct {
+		secret string
+		rcode  int
+	}{
+		{secret: secret, rcode: dns.RcodeSuccess},
+		{secret: base64.StdEncoding.EncodeToString([]byte("other")), rcode: dns.RcodeNotAuth},
+	} {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+
+		c := &dns.Client{TsigSecret: map[string]string{key: tc.secret}}
+		resp, _, err := c.Exchange(m, pc.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("Expected no error for signed request, got %s", err)
+		}
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Expected rcode %d, got %d", tc.rcode, resp.Rcode)
+		}
+	}
+}
+
+func TestNoTsigSecret(t *testing.T) {
+	s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", testPlugin{})})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+	if s.tsigSecret != nil {
+		t.Errorf("Expected TSIG secrets to be nil if none are set")
+	}
+}
@@ -48,11 +48,35 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 
 	mt, _ := response.Typify(req, time.Now().UTC()) // TODO(miek): need opt record here?
 	if mt == response.Delegation {
+		// NS and glue records are not authoritative, only DS records and denial of
+		// their existence supplied by the backend are signed.
+		for _, r := range rrSets(req.Ns) {
+			if t := r[0].Header().Rrtype; t != dns.TypeDS && t != dns.TypeNSEC && t != dns.TypeNSEC3 {
+				continue
+			}
+			ttl := r[0].Header().Ttl
+			if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
+				req.Ns = append(req.Ns, sigs...)
+			}
+		}
 		return req
 	}
 
 	if mt == response.NameError || mt == response.NoData {
-		if req.Ns[0].Header().Rrtype != dns.TypeSOA || len(req.Ns) > 1 {
+		if req.Ns[0].Header().Rrtype != dns.TypeSOA {
+			return req
+		}
+		if len(req.Ns) > 1 {
+			// The backend supplied its own denial of existence records, sign them instead of black lies.
+			if !denialOnly(req.Ns[1:]) {
+				return req
+			}
+			for _, r := range rrSets(req.Ns) {
+				ttl := r[0].Header().Ttl
+				if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
+					req.Ns = append(req.Ns, sigs...)
+				}
+			}
 			return req
 		}
 
@@ -146,6 +170,16 @@ func (d Dnssec) get(key uint64, server string) ([]dns.RR, bool) {
 	return nil, false
 }
 
+// denialOnly checks whether all records are NSEC or NSEC3 ones.
+func denialOnly(rrs []dns.RR) bool {
+	for _, r := range rrs {
+		if t := r.Header().Rrtype; t != dns.TypeNSEC && t != dns.TypeNSEC3 {
+			return false
+		}
+	}
+	return true
+}
+
 func incepExpir(now time.Time) (uint32, uint32) {
 	incep := uint32(now.Add(-3 * time.Hour).Unix()) // -(2+1) hours, be sure to catch daylight saving time and such
 	expir := uint32(now.Add(eightDays).Unix())      // sign for 8 days
@@ -123,6 +123,54 @@ func TestSigningEmpty(t *testing.T) {
 	}
 }
 
+func TestSigningDelegation(t *testing.T) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	defer rm1()
+	defer rm2()
+
+	m := &dns.Msg{
+		Ns: []dns.RR{
+			test.NS("sub.miek.nl.	1800	IN	NS	ns.sub.miek.nl."),
+			test.DS("sub.miek.nl.	1800	IN	DS	12345 13 2 BDDF6E6A4C5E0E5E2B4A1D5E8C0B6F1B1E8E7C1C9D4A2F3E5A7B9C1D3E5F7A9B"),
+		},
+		Extra: []dns.RR{test.A("ns.sub.miek.nl.	1800	IN	A	127.0.0.1")},
+	}
+	m.SetQuestion("a.sub.miek.nl.", dns.TypeA)
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+	if !section(m.Ns, 1) {
+		t.Errorf("Authority section should have 1 RRSIG")
+	}
+	if !section(m.Extra, 0) {
+		t.Errorf("Additional section should have no RRSIGs")
+	}
+}
+
+func TestSigningSuppliedDenial(t *testing.T) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	defer rm1()
+	defer rm2()
+
+	m := testEmptyMsg()
+	m.SetQuestion("a.miek.nl.", dns.TypeAAAA)
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "a.miek.nl.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+		NextDomain: "\\000.a.miek.nl.",
+		TypeBitMap: []uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC},
+	}
+	m.Ns = append(m.Ns, nsec)
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+	if !section(m.Ns, 2) {
+		t.Errorf("Authority section should have 2 RRSIGs")
+	}
+	for _, r := range m.Ns {
+		if x, ok := r.(*dns.NSEC); ok && x != nsec {
+			t.Errorf("Supplied NSEC record should be used instead of black lies")
+		}
+	}
+}
+
 func section(rss []dns.RR, nrSigs int) bool {
 	i := 0
 	for _, r := range rss {
@@ -1,6 +1,21 @@
 package dnssec
 
-import "github.com/miekg/dns"
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Sign signs rrs with the key. The signature is valid for eight days starting three hours before now.
+// It can be used by plugins signing data outside of responses, e.g. zone transfers.
+func (k *DNSKEY) Sign(rrs []dns.RR, signerName string, ttl uint32, now time.Time) (*dns.RRSIG, error) {
+	incep, expir := incepExpir(now)
+	sig := k.newRRSIG(signerName, ttl, incep, expir)
+	if err := sig.Sign(k.s, rrs); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
 
 // newRRSIG returns a new RRSIG, with all fields filled out, except the signed data.
 func (k *DNSKEY) newRRSIG(signerName string, ttl, incep, expir uint32) *dns.RRSIG {
@@ -19,6 +19,7 @@ type recordInfo struct {
 	endpoint     string
 	record       dns.RR
 	distanceInfo *DistanceInfo
+	weight       uint32
 }
 
 func (r *recordInfo) String() string {
@@ -30,6 +31,8 @@ type ResponseFilter struct {
 	dns.ResponseWriter
 	filter *filter
 	client net.IP
+	// weights are the endpoint weights of the request, they take precedence over the configured ones.
+	weights []endpointWeight
 }
 
 // NewResponseFilter makes and returns a new response filter.
@@ -50,8 +53,10 @@ func (r *ResponseFilter) WriteMsg(res *dns.Msg) error {
 	}
 
 	clientInf := r.filter.db.IPInfo(r.client)
+	clientRule := r.filter.policy.match(r.client, clientInf)
 	if clientInf.IsEmpty() {
 		log.Warningf(formErrMessage(r.client))
+		res.Answer = r.filter.allowed(clientRule, res.Answer)
 		if r.filter.maxRecords < len(res.Answer) {
 			res.Answer = res.Answer[:r.filter.maxRecords]
 		}
@@ -66,21 +71,58 @@ func (r *ResponseFilter) WriteMsg(res *dns.Msg) error {
 			log.Warningf("couldn't get an endpoint: wrong record type: %s", rec.String())
 			continue
 		}
+		ip := net.ParseIP(endpoint)
+		serverInf := r.filter.db.IPInfo(ip)
+		if !clientRule.allows(ip, serverInf) {
+			log.Debugf("endpoint %s isn't allowed for client %s", endpoint, r.client)
+			continue
+		}
+
 		var distInfo *DistanceInfo
-		serverInf := r.filter.db.IPInfo(net.ParseIP(endpoint))
 		if serverInf.IsEmpty() {
 			log.Debugf(formErrMessage(rec))
 			distInfo = &DistanceInfo{Distance: maxDistance}
 		} else {
 			distInfo = distance(clientInf, serverInf)
+			distInfo.NetworkMatched = r.filter.sameNetwork(clientInf.ASN, serverInf.ASN)
 		}
-		recInfos = append(recInfos, recordInfo{endpoint: endpoint, record: rec, distanceInfo: distInfo})
+		recInfos = append(recInfos, recordInfo{endpoint: endpoint, record: rec, distanceInfo: distInfo, weight: r.weight(ip)})
 	}
 
-	res.Answer = chooseClosest(recInfos, r.filter.maxRecords)
+	res.Answer = r.filter.chooseClosest(recInfos)
 	return r.ResponseWriter.WriteMsg(res)
 }
 
+// allowed returns the records of the endpoints allowed by the rule, records without endpoints are kept.
+func (f *filter) allowed(clientRule *rule, answer []dns.RR) []dns.RR {
+	if clientRule == nil {
+		return answer
+	}
+
+	res := make([]dns.RR, 0, len(answer))
+	for _, rec := range answer {
+		if endpoint := getEndpointFromRecord(rec); endpoint != "" {
+			ip := net.ParseIP(endpoint)
+			if !clientRule.allows(ip, f.db.IPInfo(ip)) {
+				continue
+			}
+		}
+		res = append(res, rec)
+	}
+	return res
+}
+
+// weight returns the weight of the endpoint.
+func (r *ResponseFilter) weight(ip net.IP) uint32 {
+	if w, ok := lookupWeight(r.weights, ip); ok {
+		return w
+	}
+	if w, ok := lookupWeight(r.filter.weights, ip); ok {
+		return w
+	}
+	return defaultWeight
+}
+
 func getEndpointFromRecord(record dns.RR) (endpoint string) {
 	if aRec, ok := record.(*dns.A); ok {
 		endpoint = aRec.A.String()
@@ -106,19 +148,16 @@ func distance(from, to *IPInformation) *DistanceInfo {
 	}
 
 	var fromCountry, toCountry uint
-	fromLocation, toLocation := emptyLocation.Location, emptyLocation.Location
 	if from.City != nil {
 		fromCountry = from.City.Country.GeoNameID
-		fromLocation = from.City.Location
 	}
 	if to.City != nil {
 		toCountry = to.City.Country.GeoNameID
-		toLocation = to.City.Location
 	}
 
-	if fromLocation != emptyLocation.Location && toLocation != emptyLocation.Location {
-		ll1 := s2.LatLngFromDegrees(fromLocation.Latitude, fromLocation.Longitude)
-		ll2 := s2.LatLngFromDegrees(toLocation.Latitude, toLocation.Longitude)
+	if from.hasLocation() && to.hasLocation() {
+		ll1 := s2.LatLngFromDegrees(from.City.Location.Latitude, from.City.Location.Longitude)
+		ll2 := s2.LatLngFromDegrees(to.City.Location.Latitude, to.City.Location.Longitude)
 		angle := ll1.Distance(ll2)
 		res.Distance = math.Abs(angle.Degrees())
 	}
@@ -129,12 +168,13 @@ func distance(from, to *IPInformation) *DistanceInfo {
 	if toCountry == 0 && to.Country != nil {
 		toCountry = to.Country.Country.GeoNameID
 	}
-	res.CountryMatched = fromCountry == toCountry
+	res.CountryMatched = fromCountry != 0 && fromCountry == toCountry
 
 	return res
 }
 
-func chooseClosest(recInfos []recordInfo, max int) []dns.RR {
+func (f *filter) chooseClosest(recInfos []recordInfo) []dns.RR {
+	max := f.maxRecords
 	if len(recInfos) < max {
 		max = len(recInfos)
 	}
@@ -143,12 +183,18 @@ func chooseClosest(recInfos []recordInfo, max int) []dns.RR {
 		di1 := recInfos[i].distanceInfo
 		di2 := recInfos[j].distanceInfo
 
+		// Endpoints in the network of the client are preferred regardless of distance.
+		if di1.NetworkMatched != di2.NetworkMatched {
+			return di1.NetworkMatched
+		}
+
 		if di1.Distance == maxDistance && di2.Distance == maxDistance {
 			return di1.CountryMatched
 		}
 
 		return di1.Distance < di2.Distance
 	})
+	f.spread(recInfos)
 
 	results := make([]dns.RR, max)
 	for i := 0; i < max; i++ {
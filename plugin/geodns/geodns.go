@@ -2,16 +2,14 @@ package geodns
 
 import (
 	"context"
-	"fmt"
+	"math/rand"
 	"net"
-	"os"
-	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/miekg/dns"
-	"github.com/oschwald/geoip2-golang"
 )
 
 var log = clog.NewWithPlugin(pluginName)
@@ -19,46 +17,70 @@ var log = clog.NewWithPlugin(pluginName)
 type GeoDNS struct {
 	Next   plugin.Handler
 	filter *filter
+	// reload is the interval of polling the db directory for changes, zero disables reloading.
+	reload time.Duration
 }
 
 type filter struct {
 	db         *db
 	maxRecords int
+	// peering maps autonomous systems to the ones that are preferred as the same network.
+	peering map[uint]map[uint]struct{}
+	// policy restricts the endpoints allowed for clients, nil allows all of them.
+	policy *policy
+	// band is the distance (in degrees) from the closest endpoint, endpoints within it are chosen
+	// by weighted random, zero disables it.
+	band float64
+	// weights are the configured endpoint weights, weightTXT enables weights from TXT records.
+	weights   []endpointWeight
+	weightTXT bool
+	// weightCache keeps TXT weights of the names.
+	weightCache *cache.Cache
+	rand        func() float64
 }
 
-func newGeoDNS(dbPath string, maxRecords int) (*GeoDNS, error) {
-	entries, err := os.ReadDir(dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't read dir with dbs: %w", err)
+// sameNetwork checks whether the autonomous systems are the same or peering ones.
+func (f *filter) sameNetwork(a, b uint) bool {
+	if a == 0 || b == 0 {
+		return false
 	}
+	if a == b {
+		return true
+	}
+	_, ok := f.peering[a][b]
+	return ok
+}
 
-	db := &db{readers: make(map[int]*geoip2.Reader)}
-	count := 0
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".mmdb") {
-			continue
-		}
-		r, err := geoip2.Open(filepath.Join(dbPath, entry.Name()))
-		if err != nil {
-			fmt.Printf("failed to open database file: %s, error: %v\n", entry.Name(), err)
-			continue
+// addPeering makes all the autonomous systems of the group peering with each other.
+func (f *filter) addPeering(group []uint) {
+	if f.peering == nil {
+		f.peering = make(map[uint]map[uint]struct{})
+	}
+	for _, a := range group {
+		for _, b := range group {
+			if a == b {
+				continue
+			}
+			if f.peering[a] == nil {
+				f.peering[a] = make(map[uint]struct{})
+			}
+			f.peering[a][b] = struct{}{}
 		}
+	}
+}
 
-		dbType, err := getDBType(r)
-		if err != nil {
-			fmt.Printf("failed to get database type: %s, error: %v\n", entry.Name(), err)
-			continue
-		}
-		db.AddReader(dbType, r)
-		count++
-		fmt.Printf("%s geoip db was added, type: %s\n", entry.Name(), typeToString(dbType))
+func newGeoDNS(dbPath string, maxRecords int) (*GeoDNS, error) {
+	db, err := openDB(dbPath)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Printf("Configured %d dbs. Note: when several db the same type add the last one will be used\n", count)
 
 	return &GeoDNS{
 		filter: &filter{
-			db:         db,
-			maxRecords: maxRecords,
+			db:          db,
+			maxRecords:  maxRecords,
+			weightCache: cache.New(weightCacheSize),
+			rand:        rand.Float64,
 		},
 	}, nil
 }
@@ -100,6 +122,10 @@ func (g GeoDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	}
 
 	rw := NewResponseFilter(w, g.filter, ip)
+	// Weights are used only to spread the load within the band.
+	if g.filter.weightTXT && g.filter.band != 0 {
+		rw.weights = g.lookupWeights(ctx, w, r)
+	}
 	return plugin.NextOrFailure(pluginName, g.Next, ctx, rw, r)
 }
 
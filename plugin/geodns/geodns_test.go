@@ -134,6 +134,75 @@ func TestFilteringEDNS0(t *testing.T) {
 	require.Equal(t, Orgrimar, res)
 }
 
+func TestFilteringASN(t *testing.T) {
+	ctx := context.Background()
+
+	// locations, Orgrimar and Thunder Bluff are in the same AS
+	Orgrimar := "4444:1::"
+	WarsongHold := "4444:2::"
+	Stormwind := "4444:3::"
+	ThunderBluff := "4444:4::"
+
+	for _, tc := range []struct {
+		name     string
+		client   string
+		peering  []uint
+		expected []string
+	}{
+		{
+			name:     "same as",
+			client:   ThunderBluff,
+			expected: []string{Orgrimar, WarsongHold, Stormwind},
+		},
+		{
+			name:     "peering as",
+			client:   ThunderBluff,
+			peering:  []uint{64501, 64503},
+			expected: []string{Orgrimar, Stormwind, WarsongHold},
+		},
+		{
+			name:     "peering as farther than closest",
+			client:   WarsongHold,
+			peering:  []uint{64502, 64503},
+			expected: []string{WarsongHold, Stormwind, Orgrimar},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			geoDNS, err := newGeoDNS("testdata", 3)
+			require.NoError(t, err)
+			if tc.peering != nil {
+				geoDNS.filter.addPeering(tc.peering)
+			}
+			geoDNS.Next = newTestHandler(map[string][]string{
+				"test.neofs": {Stormwind, WarsongHold, Orgrimar},
+			})
+
+			req := new(dns.Msg)
+			req.SetQuestion(dns.Fqdn("test.neofs"), dns.TypeAAAA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tc.client})
+			_, err = geoDNS.ServeDNS(ctx, rec, req)
+			require.NoError(t, err)
+
+			require.Equal(t, len(tc.expected), len(rec.Msg.Answer))
+			for i, expected := range tc.expected {
+				require.Equal(t, expected, rec.Msg.Answer[i].(*dns.AAAA).AAAA.String())
+			}
+		})
+	}
+}
+
+func TestSameNetwork(t *testing.T) {
+	f := &filter{}
+	f.addPeering([]uint{1, 2, 3})
+
+	require.True(t, f.sameNetwork(4, 4))
+	require.True(t, f.sameNetwork(1, 3))
+	require.True(t, f.sameNetwork(3, 2))
+	require.False(t, f.sameNetwork(1, 4))
+	require.False(t, f.sameNetwork(0, 0))
+}
+
 type testHandler struct {
 	db map[string][]string
 }
@@ -218,6 +287,16 @@ func TestDistance(t *testing.T) {
 			},
 			expected: &DistanceInfo{Distance: maxDistance, CountryMatched: true},
 		},
+		{
+			name: "unknown countries",
+			from: &IPInformation{
+				ASN: 64500,
+			},
+			to: &IPInformation{
+				ASN: 64501,
+			},
+			expected: &DistanceInfo{Distance: maxDistance},
+		},
 		{
 			name: "the same location",
 			from: &IPInformation{
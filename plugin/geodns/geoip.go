@@ -11,11 +11,24 @@ import (
 type db struct {
 	readers map[int]*geoip2.Reader
 	m       sync.RWMutex
+
+	// dir is the directory the readers are opened from, sum is the checksum of its db files
+	// and stat is the names, sizes and modification times of them.
+	dir  string
+	sum  []byte
+	stat string
+
+	// locations are the local locations of networks consulted before the dbs.
+	locations locations
+
+	stop chan struct{}
 }
 
 const (
 	isCity = 1 << iota
 	isCountry
+	isASN
+	isISP
 )
 
 var probingIP = net.ParseIP("127.0.0.1")
@@ -26,6 +39,10 @@ func typeToString(dbType int) string {
 		return "city"
 	case isCountry:
 		return "country"
+	case isASN:
+		return "asn"
+	case isISP:
+		return "isp"
 	}
 
 	return fmt.Sprintf("unkonwn type %d", dbType)
@@ -40,7 +57,11 @@ func (db *db) AddReader(dbType int, r *geoip2.Reader) {
 func (db *db) Reader(dbType int) (*geoip2.Reader, error) {
 	db.m.RLock()
 	defer db.m.RUnlock()
+	return db.reader(dbType)
+}
 
+// reader returns the reader of the type, the lock must be held by the caller.
+func (db *db) reader(dbType int) (*geoip2.Reader, error) {
 	r, ok := db.readers[dbType]
 	if !ok {
 		return nil, fmt.Errorf("db with type %d not found", dbType)
@@ -51,29 +72,56 @@ func (db *db) Reader(dbType int) (*geoip2.Reader, error) {
 type IPInformation struct {
 	City    *geoip2.City
 	Country *geoip2.Country
+	// ASN is the autonomous system number of the IP, zero if it's unknown.
+	ASN uint
+	// Subdivision is the subdivision code of the local location of the IP,
+	// the subdivisions found in the dbs are in City.
+	Subdivision string
+	// located is set if the coordinates in City are set locally, they are known even if zero.
+	located bool
 }
 
 type DistanceInfo struct {
 	Distance       float64
 	CountryMatched bool
+	// NetworkMatched is set if both IPs are in the same or peering autonomous systems.
+	NetworkMatched bool
 }
 
 func (i *IPInformation) IsEmpty() bool {
+	if i.ASN != 0 {
+		return false
+	}
+
 	if i.City == nil && i.Country == nil {
 		return true
 	}
 
-	if i.City != nil && i.City.Location == emptyLocation.Location && i.Country == nil {
+	if i.City != nil && !i.hasLocation() && i.Country == nil {
 		return true
 	}
 
 	return false
 }
 
+// hasLocation returns true if the coordinates of the IP are known.
+func (i *IPInformation) hasLocation() bool {
+	return i.City != nil && (i.located || i.City.Location != emptyLocation.Location)
+}
+
+// IPInfo looks the IP up in the local locations and then in the dbs. The lock is held during the lookup, so the readers
+// aren't closed by reload until it's done.
 func (db *db) IPInfo(ip net.IP) *IPInformation {
+	if loc := db.locations.lookup(ip); loc != nil {
+		return loc.info()
+	}
+
 	result := &IPInformation{}
 
-	cityDB, err := db.Reader(isCity)
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	cityDB, err := db.reader(isCity)
 	if err == nil {
 		city, err := cityDB.City(ip)
 		if err != nil {
@@ -84,7 +132,7 @@ func (db *db) IPInfo(ip net.IP) *IPInformation {
 		}
 	}
 
-	countryDB, err := db.Reader(isCountry)
+	countryDB, err := db.reader(isCountry)
 	if err == nil {
 		country, err := countryDB.Country(ip)
 		if err != nil {
@@ -94,6 +142,22 @@ func (db *db) IPInfo(ip net.IP) *IPInformation {
 		}
 	}
 
+	if asnDB, err := db.reader(isASN); err == nil {
+		asn, err := asnDB.ASN(ip)
+		if err != nil {
+			log.Debugf("couldn't get data from asn db: %s", err.Error())
+		} else {
+			result.ASN = asn.AutonomousSystemNumber
+		}
+	} else if ispDB, err := db.reader(isISP); err == nil {
+		isp, err := ispDB.ISP(ip)
+		if err != nil {
+			log.Debugf("couldn't get data from isp db: %s", err.Error())
+		} else {
+			result.ASN = isp.AutonomousSystemNumber
+		}
+	}
+
 	return result
 }
 
@@ -116,6 +180,13 @@ func getDBType(r *geoip2.Reader) (int, error) {
 		"DBIP-Country-Lite",
 		"DBIP-Country":
 		return isCountry, nil
+	case "GeoLite2-ASN",
+		"GeoIP2-ASN",
+		"DBIP-ASN-Lite",
+		"DBIP-ASN-Lite (compat=GeoLite2-ASN)":
+		return isASN, nil
+	case "GeoIP2-ISP":
+		return isISP, nil
 	}
 
 	return 0, fmt.Errorf("unkonwn db type: %s", r.Metadata().DatabaseType)
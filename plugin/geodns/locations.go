@@ -0,0 +1,163 @@
+package geodns
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+	"gopkg.in/yaml.v3"
+)
+
+// location is the location of the network set locally, e.g. for private ranges that aren't in the dbs.
+type location struct {
+	network *net.IPNet
+
+	CIDR        string  `yaml:"cidr"`
+	Latitude    float64 `yaml:"latitude"`
+	Longitude   float64 `yaml:"longitude"`
+	Country     string  `yaml:"country"`
+	Continent   string  `yaml:"continent"`
+	Subdivision string  `yaml:"subdivision"`
+	ASN         uint    `yaml:"asn"`
+}
+
+// locations are looked up before the dbs, the most specific network containing the IP is used.
+type locations []location
+
+// check parses the network and validates the coordinates.
+func (l *location) check() error {
+	_, network, err := net.ParseCIDR(l.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid location network: %s", l.CIDR)
+	}
+	if l.Latitude < -90 || l.Latitude > 90 || l.Longitude < -180 || l.Longitude > 180 {
+		return fmt.Errorf("invalid location coordinates of %s: %v %v", l.CIDR, l.Latitude, l.Longitude)
+	}
+	l.network = network
+	l.Country = strings.ToUpper(l.Country)
+	l.Continent = strings.ToUpper(l.Continent)
+	l.Subdivision = strings.ToUpper(l.Subdivision)
+	return nil
+}
+
+// parseLocation parses 'CIDR LATITUDE LONGITUDE [COUNTRY [CONTINENT [SUBDIVISION [ASN]]]]'.
+func parseLocation(args []string) (location, error) {
+	if len(args) < 3 || len(args) > 7 {
+		return location{}, fmt.Errorf("invalid location: %s", strings.Join(args, " "))
+	}
+
+	l := location{CIDR: args[0]}
+	var err error
+	if l.Latitude, err = strconv.ParseFloat(args[1], 64); err != nil {
+		return location{}, fmt.Errorf("invalid latitude: %s", args[1])
+	}
+	if l.Longitude, err = strconv.ParseFloat(args[2], 64); err != nil {
+		return location{}, fmt.Errorf("invalid longitude: %s", args[2])
+	}
+	optional := []*string{&l.Country, &l.Continent, &l.Subdivision}
+	for i, arg := range args[3:] {
+		if i == len(optional) {
+			asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(arg), "AS"), 10, 32)
+			if err != nil {
+				return location{}, fmt.Errorf("invalid asn: %s", arg)
+			}
+			l.ASN = uint(asn)
+			break
+		}
+		*optional[i] = arg
+	}
+
+	return l, l.check()
+}
+
+// readLocations reads the locations from YAML (.yaml or .yml) or CSV file.
+func readLocations(path string) (locations, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open locations: %w", err)
+	}
+	defer f.Close()
+
+	var res locations
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.NewDecoder(f).Decode(&res); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("couldn't decode locations: %w", err)
+		}
+		for i := range res {
+			if err := res[i].check(); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if res, err = readCSVLocations(f); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// readCSVLocations reads 'cidr,latitude,longitude[,country[,continent[,subdivision[,asn]]]]' records,
+// the header and the lines starting with '#' are skipped.
+func readCSVLocations(r io.Reader) (locations, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var res locations
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read locations: %w", err)
+		}
+		if len(res) == 0 && strings.EqualFold(record[0], "cidr") {
+			continue
+		}
+		// Empty optional fields are allowed, e.g. to set the continent without the country.
+		for len(record) > 3 && record[len(record)-1] == "" {
+			record = record[:len(record)-1]
+		}
+		l, err := parseLocation(record)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+}
+
+// lookup returns the location of the most specific network containing the IP, nil if there is none.
+func (ls locations) lookup(ip net.IP) *location {
+	var (
+		res  *location
+		best = -1
+	)
+	for i := range ls {
+		if !ls[i].network.Contains(ip) {
+			continue
+		}
+		if ones, _ := ls[i].network.Mask.Size(); ones > best {
+			res, best = &ls[i], ones
+		}
+	}
+	return res
+}
+
+// info returns the location as the data of the dbs.
+func (l *location) info() *IPInformation {
+	city := &geoip2.City{}
+	city.Location.Latitude = l.Latitude
+	city.Location.Longitude = l.Longitude
+	city.Country.IsoCode = l.Country
+	city.Continent.Code = l.Continent
+	return &IPInformation{City: city, ASN: l.ASN, Subdivision: l.Subdivision, located: true}
+}
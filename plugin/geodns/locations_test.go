@@ -0,0 +1,111 @@
+package geodns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocation(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		valid bool
+	}{
+		{args: []string{"10.0.0.0/8", "52.52", "13.405"}, valid: true},
+		{args: []string{"10.0.0.0/8", "52.52", "13.405", "de", "eu", "be", "AS64500"}, valid: true},
+		{args: []string{"10.0.0.0/8", "52.52"}},
+		{args: []string{"10.0.0.1", "52.52", "13.405"}},
+		{args: []string{"10.0.0.0/8", "north", "13.405"}},
+		{args: []string{"10.0.0.0/8", "91", "13.405"}},
+		{args: []string{"10.0.0.0/8", "52.52", "181"}},
+		{args: []string{"10.0.0.0/8", "52.52", "13.405", "DE", "EU", "BE", "asn"}},
+		{args: []string{"10.0.0.0/8", "52.52", "13.405", "DE", "EU", "BE", "64500", "extra"}},
+	} {
+		_, err := parseLocation(tc.args)
+		require.Equal(t, tc.valid, err == nil, tc.args)
+	}
+
+	l, err := parseLocation([]string{"10.0.0.0/8", "52.52", "13.405", "de", "eu", "be", "AS64500"})
+	require.NoError(t, err)
+	info := l.info()
+	require.False(t, info.IsEmpty())
+	require.Equal(t, "DE", info.CountryCode())
+	require.Equal(t, "EU", info.ContinentCode())
+	require.Equal(t, []string{"DE-BE"}, info.SubdivisionCodes())
+	require.Equal(t, uint(64500), info.ASN)
+
+	// Zero coordinates are a valid location.
+	l, err = parseLocation([]string{"10.0.0.0/8", "0", "0"})
+	require.NoError(t, err)
+	zero := l.info()
+	require.False(t, zero.IsEmpty())
+	l, err = parseLocation([]string{"10.0.0.0/8", "0", "1"})
+	require.NoError(t, err)
+	require.InDelta(t, 1, distance(zero, l.info()).Distance, 1e-9)
+}
+
+func TestReadLocations(t *testing.T) {
+	for _, file := range []string{"testdata/locations.yaml", "testdata/locations.csv"} {
+		t.Run(file, func(t *testing.T) {
+			locs, err := readLocations(file)
+			require.NoError(t, err)
+
+			l := locs.lookup(net.ParseIP("10.2.0.1"))
+			require.NotNil(t, l)
+			require.Equal(t, "DE", l.Country)
+
+			// The most specific network is used.
+			l = locs.lookup(net.ParseIP("10.1.0.1"))
+			require.NotNil(t, l)
+			require.Equal(t, "US", l.Country)
+			require.Equal(t, "CA", l.Subdivision)
+			require.Equal(t, uint(64500), l.ASN)
+
+			require.Nil(t, locs.lookup(net.ParseIP("192.168.0.1")))
+		})
+	}
+
+	_, err := readLocations("testdata/unknown.csv")
+	require.Error(t, err)
+}
+
+func TestFilteringLocations(t *testing.T) {
+	ctx := context.Background()
+
+	// locations
+	Orgrimar := "4444:1::"
+	WarsongHold := "4444:2::"
+	PrivateNearThunderBluff := "fd00::1"
+
+	geoDNS, err := newGeoDNS("testdata", 2)
+	require.NoError(t, err)
+	for _, args := range [][]string{
+		{"10.0.0.0/8", "26", "-78"},
+		{"fd00::/8", "26", "-77"},
+		// Overrides the location of the db.
+		{"4444:2::/64", "26.1", "-78"},
+	} {
+		l, err := parseLocation(args)
+		require.NoError(t, err)
+		geoDNS.filter.db.locations = append(geoDNS.filter.db.locations, l)
+	}
+	geoDNS.Next = newTestHandler(map[string][]string{
+		"test.neofs": {Orgrimar, PrivateNearThunderBluff, WarsongHold},
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("test.neofs"), dns.TypeAAAA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "10.1.2.3"})
+	_, err = geoDNS.ServeDNS(ctx, rec, req)
+	require.NoError(t, err)
+
+	require.Len(t, rec.Msg.Answer, 2)
+	require.Equal(t, WarsongHold, rec.Msg.Answer[0].(*dns.AAAA).AAAA.String())
+	require.Equal(t, PrivateNearThunderBluff, rec.Msg.Answer[1].(*dns.AAAA).AAAA.String())
+}
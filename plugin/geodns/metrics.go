@@ -0,0 +1,25 @@
+package geodns
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// reloads is a counter of successful db reloads.
+	reloads = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "reloads_total",
+		Help:      "Counter of successful geoip db reloads.",
+	})
+	// reloadFailures is a counter of failed db reloads.
+	reloadFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "reload_failures_total",
+		Help:      "Counter of failed geoip db reloads.",
+	})
+)
@@ -0,0 +1,192 @@
+package geodns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	selectCountry = iota
+	selectContinent
+	selectSubdivision
+	selectCIDR
+)
+
+const defaultRule = "default"
+
+// selector matches IPs by their location codes or network.
+type selector struct {
+	kind int
+	code string
+	cidr *net.IPNet
+}
+
+// rule restricts endpoints of the matching clients to the allowed ones.
+type rule struct {
+	clients []selector
+	allowed []selector
+}
+
+// policy is the list of rules, the first one matching the client is used, otherwise the default one.
+type policy struct {
+	rules []rule
+	def   *rule
+}
+
+// parseSelector parses 'country:CODE', 'continent:CODE', 'subdivision:COUNTRY-CODE' or CIDR.
+func parseSelector(s string) (selector, error) {
+	if _, cidr, err := net.ParseCIDR(s); err == nil {
+		return selector{kind: selectCIDR, cidr: cidr}, nil
+	}
+
+	kind, code, ok := cut(s, ":")
+	if !ok {
+		return selector{}, fmt.Errorf("invalid selector: %s", s)
+	}
+
+	code = strings.ToUpper(code)
+	if code == "" {
+		return selector{}, fmt.Errorf("invalid selector: %s", s)
+	}
+	switch kind {
+	case "country":
+		return selector{kind: selectCountry, code: code}, nil
+	case "continent":
+		return selector{kind: selectContinent, code: code}, nil
+	case "subdivision":
+		if !strings.Contains(code, "-") {
+			return selector{}, fmt.Errorf("subdivision must be prefixed with the country code: %s", s)
+		}
+		return selector{kind: selectSubdivision, code: code}, nil
+	}
+	return selector{}, fmt.Errorf("invalid selector: %s", s)
+}
+
+func parseSelectors(args []string) ([]selector, error) {
+	res := make([]selector, 0, len(args))
+	for _, arg := range args {
+		s, err := parseSelector(arg)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// addRule adds the rule for the comma-separated client selectors or the default rule.
+func (p *policy) addRule(clients string, allowed []string) error {
+	r := rule{}
+	var err error
+	if r.allowed, err = parseSelectors(allowed); err != nil {
+		return err
+	}
+
+	if clients == defaultRule {
+		if p.def != nil {
+			return fmt.Errorf("default rule is already set")
+		}
+		p.def = &r
+		return nil
+	}
+
+	if r.clients, err = parseSelectors(strings.Split(clients, ",")); err != nil {
+		return err
+	}
+	p.rules = append(p.rules, r)
+	return nil
+}
+
+// match returns the rule of the client, nil means all endpoints are allowed.
+func (p *policy) match(ip net.IP, info *IPInformation) *rule {
+	if p == nil {
+		return nil
+	}
+	for i := range p.rules {
+		if matchAny(p.rules[i].clients, ip, info) {
+			return &p.rules[i]
+		}
+	}
+	return p.def
+}
+
+// allows checks whether the endpoint is allowed by the rule.
+func (r *rule) allows(ip net.IP, info *IPInformation) bool {
+	return r == nil || matchAny(r.allowed, ip, info)
+}
+
+func matchAny(selectors []selector, ip net.IP, info *IPInformation) bool {
+	for _, s := range selectors {
+		if s.match(ip, info) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s selector) match(ip net.IP, info *IPInformation) bool {
+	switch s.kind {
+	case selectCIDR:
+		return ip != nil && s.cidr.Contains(ip)
+	case selectCountry:
+		return info.CountryCode() == s.code
+	case selectContinent:
+		return info.ContinentCode() == s.code
+	case selectSubdivision:
+		for _, code := range info.SubdivisionCodes() {
+			if code == s.code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CountryCode returns the ISO code of the country of the IP.
+func (i *IPInformation) CountryCode() string {
+	if i.City != nil && i.City.Country.IsoCode != "" {
+		return strings.ToUpper(i.City.Country.IsoCode)
+	}
+	if i.Country != nil {
+		return strings.ToUpper(i.Country.Country.IsoCode)
+	}
+	return ""
+}
+
+// ContinentCode returns the code of the continent of the IP.
+func (i *IPInformation) ContinentCode() string {
+	if i.City != nil && i.City.Continent.Code != "" {
+		return strings.ToUpper(i.City.Continent.Code)
+	}
+	if i.Country != nil {
+		return strings.ToUpper(i.Country.Continent.Code)
+	}
+	return ""
+}
+
+// SubdivisionCodes returns the codes of the subdivisions of the IP prefixed with the country code.
+func (i *IPInformation) SubdivisionCodes() []string {
+	country := i.CountryCode()
+	if i.City == nil || country == "" {
+		return nil
+	}
+	codes := make([]string, 0, len(i.City.Subdivisions)+1)
+	if i.Subdivision != "" {
+		codes = append(codes, country+"-"+strings.ToUpper(i.Subdivision))
+	}
+	for _, sub := range i.City.Subdivisions {
+		if sub.IsoCode != "" {
+			codes = append(codes, country+"-"+strings.ToUpper(sub.IsoCode))
+		}
+	}
+	return codes
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,149 @@
+package geodns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		kind  int
+		code  string
+		valid bool
+	}{
+		{s: "country:de", kind: selectCountry, code: "DE", valid: true},
+		{s: "continent:EU", kind: selectContinent, code: "EU", valid: true},
+		{s: "subdivision:us-ca", kind: selectSubdivision, code: "US-CA", valid: true},
+		{s: "10.0.0.0/8", kind: selectCIDR, valid: true},
+		{s: "subdivision:CA"},
+		{s: "country:"},
+		{s: "city:Berlin"},
+		{s: "10.0.0.1"},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			s, err := parseSelector(tc.s)
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.kind, s.kind)
+			require.Equal(t, tc.code, s.code)
+		})
+	}
+}
+
+func TestPolicyMatch(t *testing.T) {
+	p := &policy{}
+	require.NoError(t, p.addRule("continent:EU,country:CH", []string{"continent:EU", "country:CH"}))
+	require.NoError(t, p.addRule("subdivision:US-CA", []string{"subdivision:US-CA", "10.0.0.0/8"}))
+	require.NoError(t, p.addRule("default", []string{"country:US"}))
+	require.Error(t, p.addRule("default", []string{"country:DE"}))
+	require.Error(t, p.addRule("country:DE,", []string{"country:DE"}))
+
+	var de, ch, ca, us geoip2.City
+	de.Country.IsoCode, de.Continent.Code = "DE", "EU"
+	ch.Country.IsoCode = "CH"
+	us.Country.IsoCode, us.Continent.Code = "US", "NA"
+	ca.Country.IsoCode, ca.Continent.Code = "US", "NA"
+
+	deInfo := &IPInformation{City: &de}
+	chInfo := &IPInformation{City: &ch}
+	caInfo := &IPInformation{City: &ca, Subdivision: "CA"}
+	usInfo := &IPInformation{City: &us}
+	empty := &IPInformation{}
+	private := net.ParseIP("10.0.0.1")
+
+	r := p.match(nil, deInfo)
+	require.Equal(t, &p.rules[0], r)
+	require.True(t, r.allows(nil, chInfo))
+	require.False(t, r.allows(nil, usInfo))
+	require.Equal(t, &p.rules[0], p.match(nil, chInfo))
+
+	r = p.match(nil, caInfo)
+	require.Equal(t, &p.rules[1], r)
+	require.True(t, r.allows(nil, caInfo))
+	require.True(t, r.allows(private, empty))
+	require.False(t, r.allows(nil, usInfo))
+
+	require.Equal(t, p.def, p.match(nil, usInfo))
+	require.Equal(t, p.def, p.match(private, empty))
+
+	var nilPolicy *policy
+	require.Nil(t, nilPolicy.match(nil, deInfo))
+	require.True(t, nilPolicy.match(nil, deInfo).allows(nil, usInfo))
+}
+
+func TestFilteringPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	// locations
+	Orgrimar := "4444:1::"
+	WarsongHold := "4444:2::"
+	Stormwind := "4444:3::"
+	ThunderBluff := "4444:4::"
+	LocationNotInDB := "127.0.0.1"
+
+	for _, tc := range []struct {
+		name     string
+		client   string
+		rules    [][]string
+		expected []string
+	}{
+		{
+			name:     "closer endpoint isn't allowed",
+			client:   ThunderBluff,
+			rules:    [][]string{{"4444:4::/64", "4444:2::/64", "4444:3::/64"}},
+			expected: []string{WarsongHold, Stormwind},
+		},
+		{
+			name:     "default rule",
+			client:   ThunderBluff,
+			rules:    [][]string{{"4444:2::/64", "4444:2::/64"}, {"default", "4444:3::/64"}},
+			expected: []string{Stormwind},
+		},
+		{
+			name:     "client location not in db",
+			client:   LocationNotInDB,
+			rules:    [][]string{{"default", "4444:2::/64", "4444:3::/64"}},
+			expected: []string{Stormwind, WarsongHold},
+		},
+		{
+			name:   "nothing allowed",
+			client: ThunderBluff,
+			rules:  [][]string{{"default", "10.0.0.0/8"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			geoDNS, err := newGeoDNS("testdata", 3)
+			require.NoError(t, err)
+			geoDNS.filter.policy = &policy{}
+			for _, r := range tc.rules {
+				require.NoError(t, geoDNS.filter.policy.addRule(r[0], r[1:]))
+			}
+			geoDNS.Next = newTestHandler(map[string][]string{
+				"test.neofs": {Stormwind, Orgrimar, WarsongHold},
+			})
+
+			req := new(dns.Msg)
+			req.SetQuestion(dns.Fqdn("test.neofs"), dns.TypeAAAA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tc.client})
+			_, err = geoDNS.ServeDNS(ctx, rec, req)
+			require.NoError(t, err)
+
+			require.Equal(t, len(tc.expected), len(rec.Msg.Answer))
+			for i, expected := range tc.expected {
+				require.Equal(t, expected, rec.Msg.Answer[i].(*dns.AAAA).AAAA.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package geodns
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+const defaultReload = time.Minute
+
+// openDB opens the dbs of the directory. Files that can't be opened are skipped.
+func openDB(dir string) (*db, error) {
+	stat, err := dirStat(dir)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := dirChecksum(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	readers, errs := openReaders(dir)
+	for _, err := range errs {
+		log.Warning(err)
+	}
+	log.Infof("Configured %d dbs. Note: when several db the same type add the last one will be used", len(readers))
+
+	return &db{
+		readers: readers,
+		dir:     dir,
+		sum:     sum,
+		stat:    stat,
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// openReaders opens all the dbs of the directory, errors of the files that can't be opened are returned.
+func openReaders(dir string) (map[int]*geoip2.Reader, []error) {
+	files, err := dbFiles(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var (
+		readers = make(map[int]*geoip2.Reader)
+		errs    []error
+	)
+	for _, file := range files {
+		r, err := geoip2.Open(filepath.Join(dir, file))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to open database file: %s, error: %w", file, err))
+			continue
+		}
+
+		dbType, err := getDBType(r)
+		if err != nil {
+			r.Close()
+			errs = append(errs, fmt.Errorf("failed to get database type: %s, error: %w", file, err))
+			continue
+		}
+		if old, ok := readers[dbType]; ok {
+			old.Close()
+		}
+		readers[dbType] = r
+		log.Infof("%s geoip db was added, type: %s", file, typeToString(dbType))
+	}
+
+	return readers, errs
+}
+
+// dbFiles returns the names of the db files of the directory in lexical order.
+func dbFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read dir with dbs: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".mmdb") {
+			continue
+		}
+		files = append(files, entry.Name())
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// dirStat returns the names, sizes and modification times of the db files of the directory.
+// It's cheap to get, so the files are hashed only when it changes.
+func dirStat(dir string) (string, error) {
+	files, err := dbFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// dirChecksum returns the checksum of the names and contents of the db files of the directory.
+func dirChecksum(dir string) ([]byte, error) {
+	files, err := dbFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	for _, file := range files {
+		f, err := os.Open(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		_, _ = io.WriteString(h, file)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// Reload swaps the readers if the db files of the directory have changed. The files are hashed only
+// if their names, sizes or modification times differ from the last check. The old readers are closed
+// once in-flight lookups are done. If any file can't be opened, the readers are kept as they are.
+func (db *db) Reload() (bool, error) {
+	stat, err := dirStat(db.dir)
+	if err != nil {
+		return false, err
+	}
+	if stat == db.stat {
+		return false, nil
+	}
+	sum, err := dirChecksum(db.dir)
+	if err != nil {
+		return false, err
+	}
+	if string(sum) == string(db.sum) {
+		db.stat = stat
+		return false, nil
+	}
+
+	readers, errs := openReaders(db.dir)
+	if len(errs) != 0 {
+		for _, r := range readers {
+			r.Close()
+		}
+		return false, errs[0]
+	}
+
+	db.m.Lock()
+	old := db.readers
+	db.readers = readers
+	db.m.Unlock()
+
+	for _, r := range old {
+		r.Close()
+	}
+	db.sum = sum
+	db.stat = stat
+	return true, nil
+}
+
+// Watch polls the directory and reloads the dbs when they change. If interval is zero, no reloading will be done.
+func (db *db) Watch(interval time.Duration) {
+	if interval == 0 {
+		return
+	}
+	tick := time.NewTicker(interval)
+
+	go func() {
+		for {
+			select {
+			case <-tick.C:
+				reloaded, err := db.Reload()
+				if err != nil {
+					reloadFailures.Inc()
+					log.Errorf("Failed to reload dbs in %q: %v", db.dir, err)
+					continue
+				}
+				if reloaded {
+					reloads.Inc()
+					log.Infof("Successfully reloaded dbs in %q", db.dir)
+				}
+
+			case <-db.stop:
+				tick.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops watching the directory and closes the readers.
+func (db *db) Stop() error {
+	close(db.stop)
+
+	db.m.Lock()
+	defer db.m.Unlock()
+	for _, r := range db.readers {
+		r.Close()
+	}
+	db.readers = make(map[int]*geoip2.Reader)
+	return nil
+}
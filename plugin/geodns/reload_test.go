@@ -0,0 +1,62 @@
+package geodns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "GeoIP2-City-Test.mmdb"))
+	require.NoError(t, err)
+
+	db, err := openDB(dir)
+	require.NoError(t, err)
+	require.True(t, db.IPInfo(net.ParseIP("4444:1::")).IsEmpty())
+
+	reloaded, err := db.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "city.mmdb"), data, 0o644))
+	reloaded, err = db.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.False(t, db.IPInfo(net.ParseIP("4444:1::")).IsEmpty())
+	old, err := db.Reader(isCity)
+	require.NoError(t, err)
+
+	// Broken files fail the reload, the current readers are kept.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.mmdb"), []byte("broken"), 0o644))
+	_, err = db.Reload()
+	require.Error(t, err)
+	r, err := db.Reader(isCity)
+	require.NoError(t, err)
+	require.True(t, old == r)
+
+	// Touched files with the same contents aren't reloaded.
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken.mmdb")))
+	mtime := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "city.mmdb"), mtime, mtime))
+	reloaded, err = db.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "city2.mmdb"), data, 0o644))
+	reloaded, err = db.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	r, err = db.Reader(isCity)
+	require.NoError(t, err)
+	require.True(t, old != r)
+	require.False(t, db.IPInfo(net.ParseIP("4444:1::")).IsEmpty())
+
+	require.NoError(t, db.Stop())
+	_, err = db.Reader(isCity)
+	require.Error(t, err)
+}
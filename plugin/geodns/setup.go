@@ -2,7 +2,11 @@ package geodns
 
 import (
 	"fmt"
+	"math"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
@@ -21,6 +25,13 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error(pluginName, err)
 	}
 
+	db := geoDNS.filter.db
+	c.OnStartup(func() error {
+		db.Watch(geoDNS.reload)
+		return nil
+	})
+	c.OnShutdown(db.Stop)
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		geoDNS.Next = next
 		return geoDNS
@@ -45,9 +56,124 @@ func geoDNSParse(c *caddy.Controller) (*GeoDNS, error) {
 		maxRecords = max
 	}
 
+	reload := defaultReload
+	var (
+		peering   [][]uint
+		rules     *policy
+		band      float64
+		weights   []endpointWeight
+		weightTXT bool
+		locs      locations
+	)
+	for c.NextBlock() {
+		switch c.Val() {
+		case "reload":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			d, err := time.ParseDuration(args[0])
+			if err != nil || d < 0 {
+				return nil, c.Errf("invalid reload interval: %s", args[0])
+			}
+			reload = d
+		case "peering":
+			// peering ASN ASN...
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return nil, c.ArgErr()
+			}
+			group := make([]uint, len(args))
+			for i, arg := range args {
+				asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(arg), "AS"), 10, 32)
+				if err != nil || asn == 0 {
+					return nil, c.Errf("invalid asn: %s", arg)
+				}
+				group[i] = uint(asn)
+			}
+			peering = append(peering, group)
+		case "rule":
+			// rule default|CLIENT_SELECTOR[,CLIENT_SELECTOR...] ENDPOINT_SELECTOR...
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return nil, c.ArgErr()
+			}
+			if rules == nil {
+				rules = &policy{}
+			}
+			if err := rules.addRule(args[0], args[1:]); err != nil {
+				return nil, c.Err(err.Error())
+			}
+		case "band":
+			// band DISTANCE_KM
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			km, err := strconv.ParseFloat(args[0], 64)
+			if err != nil || km < 0 || math.IsNaN(km) || math.IsInf(km, 0) {
+				return nil, c.Errf("invalid distance band: %s", args[0])
+			}
+			band = km / kmPerDegree
+		case "weight":
+			// weight WEIGHT ADDRESS|CIDR...
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return nil, c.ArgErr()
+			}
+			w, err := parseWeight(args[0], args[1:])
+			if err != nil {
+				return nil, c.Err(err.Error())
+			}
+			weights = append(weights, w...)
+		case "location":
+			// location CIDR LATITUDE LONGITUDE [COUNTRY [CONTINENT [SUBDIVISION [ASN]]]]
+			l, err := parseLocation(c.RemainingArgs())
+			if err != nil {
+				return nil, c.Err(err.Error())
+			}
+			locs = append(locs, l)
+		case "locations":
+			// locations FILE
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			path := args[0]
+			if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(path) && root != "" {
+				path = filepath.Join(root, path)
+			}
+			fileLocs, err := readLocations(path)
+			if err != nil {
+				return nil, c.Err(err.Error())
+			}
+			locs = append(locs, fileLocs...)
+		case "weight_txt":
+			if len(c.RemainingArgs()) != 0 {
+				return nil, c.ArgErr()
+			}
+			weightTXT = true
+		default:
+			return nil, c.Errf("unknown property '%s'", c.Val())
+		}
+	}
+
+	if weightTXT && band == 0 {
+		return nil, c.Err("weight_txt is used only with band")
+	}
+
 	geoDNS, err := newGeoDNS(dbPath, maxRecords)
 	if err != nil {
 		return geoDNS, c.Err(err.Error())
 	}
+	geoDNS.reload = reload
+	for _, group := range peering {
+		geoDNS.filter.addPeering(group)
+	}
+	geoDNS.filter.policy = rules
+	geoDNS.filter.band = band
+	geoDNS.filter.weights = weights
+	geoDNS.filter.weightTXT = weightTXT
+	geoDNS.filter.db.locations = locs
 	return geoDNS, nil
 }
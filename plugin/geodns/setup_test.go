@@ -18,6 +18,30 @@ func TestSetup(t *testing.T) {
 		{args: "testdata/GeoIP2-City-Test.mmdb -1", valid: false},
 		{args: "testdata/", valid: true},
 		{args: "testdata 3", valid: true},
+		{args: "testdata {\n reload 10s\n}", valid: true},
+		{args: "testdata {\n reload 0\n}", valid: true},
+		{args: "testdata {\n reload\n}", valid: false},
+		{args: "testdata {\n reload -1s\n}", valid: false},
+		{args: "testdata {\n unknown\n}", valid: false},
+		{args: "testdata {\n peering 64501 AS64502\n}", valid: true},
+		{args: "testdata {\n peering 64501\n}", valid: false},
+		{args: "testdata {\n peering 64501 asn\n}", valid: false},
+		{args: "testdata {\n rule continent:EU continent:EU 10.0.0.0/8\n rule default country:US\n}", valid: true},
+		{args: "testdata {\n rule default country:US\n rule default country:DE\n}", valid: false},
+		{args: "testdata {\n rule continent:EU\n}", valid: false},
+		{args: "testdata {\n rule continent:EU city:Berlin\n}", valid: false},
+		{args: "testdata {\n band 500\n weight 3 10.0.0.1 4444:1::/64\n weight_txt\n}", valid: true},
+		{args: "testdata {\n band -1\n}", valid: false},
+		{args: "testdata {\n band NaN\n}", valid: false},
+		{args: "testdata {\n weight 0 10.0.0.1\n}", valid: false},
+		{args: "testdata {\n weight 3\n}", valid: false},
+		{args: "testdata {\n band 500\n weight_txt on\n}", valid: false},
+		{args: "testdata {\n weight_txt\n}", valid: false},
+		{args: "testdata {\n band 0\n weight_txt\n}", valid: false},
+		{args: "testdata {\n location 10.0.0.0/8 52.52 13.405 DE EU\n locations testdata/locations.yaml\n}", valid: true},
+		{args: "testdata {\n locations testdata/locations.csv\n}", valid: true},
+		{args: "testdata {\n location 10.0.0.0/8 52.52\n}", valid: false},
+		{args: "testdata {\n locations testdata/unknown.yaml\n}", valid: false},
 	} {
 		c := caddy.NewTestController("dns", "geodns "+tc.args)
 		err := setup(c)
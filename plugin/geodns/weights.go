@@ -0,0 +1,198 @@
+package geodns
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultWeight = 1
+	// weightTXTPrefix starts TXT records with endpoint weights: 'geodns-weight=WEIGHT ADDRESS...'.
+	weightTXTPrefix = "geodns-weight="
+	// kmPerDegree is the length of a degree of the great circle.
+	kmPerDegree = 6371 * math.Pi / 180
+	// weightCacheSize is the number of names TXT weights are cached for.
+	weightCacheSize = 10000
+)
+
+// cachedWeights are the TXT weights of the name, they are valid until the TTL of the records passes.
+type cachedWeights struct {
+	weights []endpointWeight
+	expires time.Time
+}
+
+// endpointWeight is the weight of endpoints in the network.
+type endpointWeight struct {
+	network *net.IPNet
+	weight  uint32
+}
+
+// parseWeight parses the weight and the addresses or CIDRs of the endpoints.
+func parseWeight(weight string, endpoints []string) ([]endpointWeight, error) {
+	w, err := strconv.ParseUint(weight, 10, 32)
+	if err != nil || w == 0 {
+		return nil, fmt.Errorf("invalid weight: %s", weight)
+	}
+
+	res := make([]endpointWeight, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		network, err := parseNetwork(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, endpointWeight{network: network, weight: uint32(w)})
+	}
+	return res, nil
+}
+
+// parseNetwork parses CIDR or IP, the latter is the network of a single address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(s); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address: %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}, nil
+}
+
+// parseTXTWeights returns the endpoint weights of TXT records, invalid records are skipped.
+func parseTXTWeights(answer []dns.RR) []endpointWeight {
+	var res []endpointWeight
+	for _, rr := range answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		data := strings.Join(txt.Txt, "")
+		if !strings.HasPrefix(data, weightTXTPrefix) {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(data, weightTXTPrefix))
+		if len(fields) < 2 {
+			log.Debugf("invalid weight record: %s", data)
+			continue
+		}
+		weights, err := parseWeight(fields[0], fields[1:])
+		if err != nil {
+			log.Debugf("invalid weight record: %s: %s", data, err)
+			continue
+		}
+		res = append(res, weights...)
+	}
+	return res
+}
+
+// lookupWeight returns the weight of the first network containing the IP.
+func lookupWeight(weights []endpointWeight, ip net.IP) (uint32, bool) {
+	for _, w := range weights {
+		if w.network.Contains(ip) {
+			return w.weight, true
+		}
+	}
+	return 0, false
+}
+
+// lookupWeights requests TXT records of the name from the next plugin to get the endpoint weights.
+// The weights are cached for the minimum TTL of the response records.
+func (g GeoDNS) lookupWeights(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) []endpointWeight {
+	key := cache.Hash([]byte(strings.ToLower(r.Question[0].Name) + "/" + strconv.Itoa(int(r.Question[0].Qclass))))
+	if el, ok := g.filter.weightCache.Get(key); ok {
+		if cached := el.(*cachedWeights); time.Now().Before(cached.expires) {
+			return cached.weights
+		}
+		g.filter.weightCache.Remove(key)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(r.Question[0].Name, dns.TypeTXT)
+	req.Question[0].Qclass = r.Question[0].Qclass
+
+	nw := nonwriter.New(w)
+	if _, err := plugin.NextOrFailure(pluginName, g.Next, ctx, nw, req); err != nil {
+		log.Debugf("couldn't get weights of %s: %s", r.Question[0].Name, err)
+		return nil
+	}
+	if nw.Msg == nil {
+		return nil
+	}
+
+	weights := parseTXTWeights(nw.Msg.Answer)
+	if ttl, ok := minTTL(nw.Msg); ok && ttl != 0 {
+		g.filter.weightCache.Add(key, &cachedWeights{
+			weights: weights,
+			expires: time.Now().Add(time.Duration(ttl) * time.Second),
+		})
+	}
+	return weights
+}
+
+// minTTL returns the minimum TTL of the answer and authority records (the SOA of negative responses),
+// false is returned if there are no such records.
+func minTTL(m *dns.Msg) (uint32, bool) {
+	var (
+		ttl   uint32
+		found bool
+	)
+	for _, rrs := range [][]dns.RR{m.Answer, m.Ns} {
+		for _, rr := range rrs {
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+	return ttl, found
+}
+
+// spread shuffles the closest endpoints (within the distance band of the closest one and in the same
+// network) by weighted random, so the load is spread between them. recInfos must be sorted.
+func (f *filter) spread(recInfos []recordInfo) {
+	if f.band == 0 || len(recInfos) < 2 {
+		return
+	}
+
+	closest := recInfos[0].distanceInfo
+	if closest.Distance == maxDistance {
+		return
+	}
+	n := 1
+	for ; n < len(recInfos); n++ {
+		di := recInfos[n].distanceInfo
+		if di.NetworkMatched != closest.NetworkMatched || di.Distance-closest.Distance > f.band {
+			break
+		}
+	}
+
+	// Endpoints are picked one by one with the probability proportional to their weights.
+	band := recInfos[:n]
+	for i := 0; i < len(band)-1; i++ {
+		var total float64
+		for _, rec := range band[i:] {
+			total += float64(rec.weight)
+		}
+		pick := f.rand() * total
+		j := i
+		for ; j < len(band)-1; j++ {
+			pick -= float64(band[j].weight)
+			if pick < 0 {
+				break
+			}
+		}
+		band[i], band[j] = band[j], band[i]
+	}
+}
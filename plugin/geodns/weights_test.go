@@ -0,0 +1,194 @@
+package geodns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTXTWeights(t *testing.T) {
+	weights := parseTXTWeights([]dns.RR{
+		test.TXT(`test.neofs. 60 IN TXT "geodns-weight=5 10.0.0.1 4444:1::/64"`),
+		test.TXT(`test.neofs. 60 IN TXT "geodns-weight=" "7 10.0.1.0/24"`),
+		test.TXT(`test.neofs. 60 IN TXT "geodns-weight=0 10.0.0.2"`),
+		test.TXT(`test.neofs. 60 IN TXT "geodns-weight=3"`),
+		test.TXT(`test.neofs. 60 IN TXT "other"`),
+		test.A("test.neofs. 60 IN A 10.0.0.1"),
+	})
+	require.Len(t, weights, 3)
+
+	for _, tc := range []struct {
+		ip     string
+		weight uint32
+		ok     bool
+	}{
+		{ip: "10.0.0.1", weight: 5, ok: true},
+		{ip: "4444:1::5", weight: 5, ok: true},
+		{ip: "10.0.1.7", weight: 7, ok: true},
+		{ip: "10.0.0.2"},
+	} {
+		w, ok := lookupWeight(weights, net.ParseIP(tc.ip))
+		require.Equal(t, tc.ok, ok, tc.ip)
+		require.Equal(t, tc.weight, w, tc.ip)
+	}
+
+	_, err := parseWeight("1", []string{"bad ip"})
+	require.Error(t, err)
+	_, err = parseWeight("-1", []string{"10.0.0.1"})
+	require.Error(t, err)
+}
+
+func TestSpread(t *testing.T) {
+	newInfos := func() []recordInfo {
+		var infos []recordInfo
+		for i, d := range []struct {
+			distance float64
+			weight   uint32
+		}{{0, 1}, {1, 1}, {2, 8}, {10, 100}, {maxDistance, 100}} {
+			infos = append(infos, recordInfo{
+				record:       test.A("test.neofs. 60 IN A 10.0.0." + string(rune('1'+i))),
+				distanceInfo: &DistanceInfo{Distance: d.distance},
+				weight:       d.weight,
+			})
+		}
+		return infos
+	}
+	endpoints := func(infos []recordInfo) string {
+		var res []string
+		for _, info := range infos {
+			res = append(res, info.record.(*dns.A).A.String())
+		}
+		return strings.Join(res, " ")
+	}
+
+	f := &filter{band: 5, rand: func() float64 { return 0.95 }}
+	infos := newInfos()
+	f.spread(infos)
+	// The heaviest endpoint within the band is picked first, the ones outside keep their order.
+	require.Equal(t, "10.0.0.3 10.0.0.1 10.0.0.2 10.0.0.4 10.0.0.5", endpoints(infos))
+
+	f.rand = func() float64 { return 0 }
+	infos = newInfos()
+	f.spread(infos)
+	require.Equal(t, "10.0.0.1 10.0.0.2 10.0.0.3 10.0.0.4 10.0.0.5", endpoints(infos))
+
+	f.band = 0
+	f.rand = func() float64 { return 0.95 }
+	infos = newInfos()
+	f.spread(infos)
+	require.Equal(t, "10.0.0.1 10.0.0.2 10.0.0.3 10.0.0.4 10.0.0.5", endpoints(infos))
+}
+
+func TestFilteringWeights(t *testing.T) {
+	ctx := context.Background()
+
+	// locations
+	Orgrimar := "4444:1::"
+	WarsongHold := "4444:2::"
+	Stormwind := "4444:3::"
+	ThunderBluff := "4444:4::"
+
+	for _, tc := range []struct {
+		name     string
+		txt      []string
+		expected string
+	}{
+		{
+			name:     "configured weights",
+			expected: Orgrimar,
+		},
+		{
+			// Stormwind is out of the band, so its weight doesn't matter.
+			name:     "txt weights",
+			txt:      []string{"geodns-weight=1000000 4444:4:: 4444:3::"},
+			expected: ThunderBluff,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			geoDNS, err := newGeoDNS("testdata", 1)
+			require.NoError(t, err)
+			geoDNS.filter.band = 10
+			geoDNS.filter.weightTXT = true
+			geoDNS.filter.weights, err = parseWeight("1000", []string{"4444:1::/64"})
+			require.NoError(t, err)
+			geoDNS.filter.rand = func() float64 { return 0.5 }
+			geoDNS.Next = weightsHandler{
+				dns.TypeAAAA: {Stormwind, ThunderBluff, Orgrimar},
+				dns.TypeTXT:  tc.txt,
+			}
+
+			req := new(dns.Msg)
+			req.SetQuestion(dns.Fqdn("test.neofs"), dns.TypeAAAA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: WarsongHold})
+			_, err = geoDNS.ServeDNS(ctx, rec, req)
+			require.NoError(t, err)
+			require.Len(t, rec.Msg.Answer, 1)
+			require.Equal(t, tc.expected, rec.Msg.Answer[0].(*dns.AAAA).AAAA.String())
+		})
+	}
+}
+
+// weightsHandler answers with the records of the requested type.
+type weightsHandler map[uint16][]string
+
+func (h weightsHandler) ServeDNS(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	req := request.Request{Req: r, W: w}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = getTestAnswers(req, h[req.QType()])
+
+	_ = w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+func (h weightsHandler) Name() string { return pluginName }
+
+func TestLookupWeights(t *testing.T) {
+	var txtQueries int
+	next := plugin.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Qtype == dns.TypeTXT {
+			txtQueries++
+			m.Answer = []dns.RR{test.TXT(`test.neofs. 60 IN TXT "geodns-weight=5 10.0.0.1"`)}
+		} else {
+			m.Answer = []dns.RR{test.A("test.neofs. 60 IN A 10.0.0.1")}
+		}
+		_ = w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+
+	geoDNS, err := newGeoDNS("testdata", 1)
+	require.NoError(t, err)
+	geoDNS.filter.weightTXT = true
+	geoDNS.Next = next
+
+	serve := func(name string) {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		_, err := geoDNS.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+		require.NoError(t, err)
+	}
+
+	// Weights aren't requested without band.
+	serve("test.neofs.")
+	require.Equal(t, 0, txtQueries)
+
+	geoDNS.filter.band = 10
+	serve("test.neofs.")
+	serve("TEST.neofs.")
+	require.Equal(t, 1, txtQueries)
+
+	serve("other.neofs.")
+	require.Equal(t, 2, txtQueries)
+}
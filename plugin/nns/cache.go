@@ -0,0 +1,251 @@
+package nns
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultCacheTTL    = time.Hour
+	defaultCacheCap    = 10000
+	heightPollInterval = time.Second
+
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
+// recordCache keeps resolved records until a new block is persisted in any
+// of the chains or the ttl passes. Empty results are cached too. Chains watched
+// via WebSocket don't expire the whole cache on new blocks, only the names
+// changed by contract notifications are invalidated.
+type recordCache struct {
+	items *cache.Cache
+	ttl   time.Duration
+	// generation is increased every time the whole cache is invalidated,
+	// items stored with the older generation are treated as expired.
+	generation uint64
+	// version is increased on every invalidation, records resolved
+	// before it are not added to the cache.
+	version uint64
+	now     func() time.Time
+
+	stop chan struct{}
+}
+
+type cacheItem struct {
+	response   *response
+	names      []string
+	generation uint64
+	stored     time.Time
+}
+
+func newRecordCache(ttl time.Duration, capacity int) *recordCache {
+	return &recordCache{
+		items: cache.New(capacity),
+		ttl:   ttl,
+		now:   time.Now,
+		stop:  make(chan struct{}),
+	}
+}
+
+// Version returns current cache version. It must be taken before resolving
+// records to be added, so that an invalidation in between is not missed.
+func (c *recordCache) Version() uint64 {
+	return atomic.LoadUint64(&c.version)
+}
+
+// Invalidate expires all cached items.
+func (c *recordCache) Invalidate() {
+	atomic.AddUint64(&c.generation, 1)
+	atomic.AddUint64(&c.version, 1)
+}
+
+// InvalidateName removes cached items resolved using NNS name or its subdomains.
+func (c *recordCache) InvalidateName(name string) {
+	atomic.AddUint64(&c.version, 1)
+
+	name = strings.ToLower(name)
+	c.items.Walk(func(items map[uint64]interface{}, key uint64) bool {
+		el, ok := items[key]
+		if !ok {
+			return true
+		}
+		for _, itemName := range el.(*cacheItem).names {
+			if itemName == name || strings.HasSuffix(itemName, dot+name) {
+				delete(items, key)
+				break
+			}
+		}
+		return true
+	})
+}
+
+// Get returns cached response for the request. Answer records are copied and
+// have owner name in the same case as the requested one.
+func (c *recordCache) Get(state request.Request) (*response, bool) {
+	return c.get(cacheKey(state), state.QName())
+}
+
+// SOA returns cached SOA record of the zone, it's nil if the zone has none.
+func (c *recordCache) SOA(zone string) (*dns.SOA, bool) {
+	res, ok := c.get(soaCacheKey(zone), zone)
+	if !ok || len(res.Ns) == 0 {
+		return nil, ok
+	}
+	return res.Ns[0].(*dns.SOA), true
+}
+
+func (c *recordCache) get(key uint64, qname string) (*response, bool) {
+	el, ok := c.items.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	item := el.(*cacheItem)
+	if item.generation != atomic.LoadUint64(&c.generation) || c.now().Sub(item.stored) > c.ttl {
+		c.items.Remove(key)
+		return nil, false
+	}
+
+	res := &response{
+		Answer:     make([]dns.RR, len(item.response.Answer)),
+		Ns:         make([]dns.RR, len(item.response.Ns)),
+		Extra:      make([]dns.RR, len(item.response.Extra)),
+		Rcode:      item.response.Rcode,
+		delegation: item.response.delegation,
+	}
+	for i, rr := range item.response.Answer {
+		res.Answer[i] = dns.Copy(rr)
+		if strings.EqualFold(rr.Header().Name, qname) {
+			res.Answer[i].Header().Name = qname
+		}
+	}
+	for i, rr := range item.response.Ns {
+		res.Ns[i] = dns.Copy(rr)
+	}
+	for i, rr := range item.response.Extra {
+		res.Extra[i] = dns.Copy(rr)
+	}
+	if item.response.denial != nil {
+		res.denial = dns.Copy(item.response.denial)
+	}
+
+	return res, true
+}
+
+// Add stores response resolved for the request using provided NNS names
+// if there were no invalidations since the version.
+func (c *recordCache) Add(state request.Request, version uint64, names []string, res *response) {
+	c.add(cacheKey(state), version, names, res)
+}
+
+// AddSOA stores SOA record of the zone (nil if it has none) resolved using NNS names
+// if there were no invalidations since the version.
+func (c *recordCache) AddSOA(zone string, version uint64, names []string, soa *dns.SOA) {
+	res := &response{}
+	if soa != nil {
+		res.Ns = []dns.RR{soa}
+	}
+	c.add(soaCacheKey(zone), version, names, res)
+}
+
+func (c *recordCache) add(key uint64, version uint64, names []string, res *response) {
+	if version != c.Version() {
+		return
+	}
+
+	lowerNames := make([]string, len(names))
+	for i := range names {
+		lowerNames[i] = strings.ToLower(names[i])
+	}
+
+	c.items.Add(key, &cacheItem{
+		response:   res,
+		names:      lowerNames,
+		generation: atomic.LoadUint64(&c.generation),
+		stored:     c.now(),
+	})
+}
+
+// WatchHeight polls block height of the contracts' chains and invalidates
+// cache when any of them grows. It returns immediately, call Stop to finish watching.
+func (c *recordCache) WatchHeight(contracts []*contract.Contract, log clog.P) {
+	watchBlocks(contracts, c.stop, log, c.Invalidate)
+}
+
+// WatchNotifications subscribes to the contract notifications via its WebSocket endpoint and
+// invalidates cached items of the changed names. It reconnects with exponential backoff
+// when the connection drops. It returns immediately, call Stop to finish watching.
+func (c *recordCache) WatchNotifications(nnsContract *contract.Contract, log clog.P) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+
+	go func() {
+		backoff := minReconnectBackoff
+		for {
+			notifications, err := nnsContract.Subscribe(ctx)
+			if err != nil {
+				log.Warningf("subscribe to contract '%s' notifications via '%s': %s, retry in %s",
+					nnsContract.Hash().StringLE(), nnsContract.WSEndpoint(), err.Error(), backoff)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return
+				}
+				if backoff *= 2; backoff > maxReconnectBackoff {
+					backoff = maxReconnectBackoff
+				}
+				continue
+			}
+
+			backoff = minReconnectBackoff
+			// Notifications could be missed while we were disconnected.
+			c.Invalidate()
+
+			for ntf := range notifications {
+				if ntf.Name == "" {
+					log.Debugf("unknown domain in '%s' notification, invalidate all records", ntf.Event)
+					c.Invalidate()
+					continue
+				}
+				log.Debugf("'%s' notification for '%s', invalidate records", ntf.Event, ntf.Name)
+				c.InvalidateName(ntf.Name)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				log.Warningf("connection to '%s' is lost, reconnecting", nnsContract.WSEndpoint())
+			}
+		}
+	}()
+}
+
+// Stop stops watching block height and notifications.
+func (c *recordCache) Stop() error {
+	close(c.stop)
+	return nil
+}
+
+func cacheKey(state request.Request) uint64 {
+	key := state.Name() + strconv.Itoa(int(state.QType())) + "/" + strconv.Itoa(int(state.QClass()))
+	return cache.Hash([]byte(key))
+}
+
+// soaCacheKey is the key of the zone SOA, it doesn't match keys of the requests.
+func soaCacheKey(zone string) uint64 {
+	return cache.Hash([]byte("soa:" + strings.ToLower(zone)))
+}
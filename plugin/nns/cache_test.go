@@ -0,0 +1,104 @@
+package nns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordCache(t *testing.T) {
+	now := time.Now()
+	c := newRecordCache(time.Minute, defaultCacheCap)
+	c.now = func() time.Time { return now }
+
+	newState := func(name string, qtype uint16) request.Request {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		return request.Request{W: &test.ResponseWriter{}, Req: req}
+	}
+
+	state := newState("test.neofs.", dns.TypeA)
+	_, ok := c.Get(state)
+	require.False(t, ok)
+
+	c.Add(state, c.Version(), []string{"test.neofs"}, &response{Answer: []dns.RR{test.A("test.neofs. 0 IN A 10.0.0.1")}})
+	res, ok := c.Get(newState("TEST.neofs.", dns.TypeA))
+	require.True(t, ok)
+	require.Len(t, res.Answer, 1)
+	require.Equal(t, "TEST.neofs.", res.Answer[0].Header().Name)
+
+	_, ok = c.Get(newState("test.neofs.", dns.TypeAAAA))
+	require.False(t, ok)
+
+	t.Run("negative", func(t *testing.T) {
+		state := newState("empty.neofs.", dns.TypeA)
+		c.Add(state, c.Version(), []string{"empty.neofs"}, &response{Rcode: dns.RcodeNameError})
+		res, ok := c.Get(state)
+		require.True(t, ok)
+		require.Empty(t, res.Answer)
+		require.Equal(t, dns.RcodeNameError, res.Rcode)
+	})
+
+	t.Run("new block", func(t *testing.T) {
+		version := c.Version()
+		c.Invalidate()
+		_, ok := c.Get(state)
+		require.False(t, ok)
+
+		// records resolved before the new block must not be cached
+		c.Add(state, version, []string{"test.neofs"}, &response{Answer: []dns.RR{test.A("test.neofs. 0 IN A 10.0.0.1")}})
+		_, ok = c.Get(state)
+		require.False(t, ok)
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		sub := newState("sub.test.neofs.", dns.TypeA)
+		other := newState("other.neofs.", dns.TypeA)
+		c.Add(state, c.Version(), []string{"test.neofs"}, &response{Answer: []dns.RR{test.A("test.neofs. 0 IN A 10.0.0.1")}})
+		c.Add(sub, c.Version(), []string{"sub.test.neofs"}, &response{Answer: []dns.RR{test.A("sub.test.neofs. 0 IN A 10.0.0.1")}})
+		c.Add(other, c.Version(), []string{"other.neofs"}, &response{Answer: []dns.RR{test.A("other.neofs. 0 IN A 10.0.0.1")}})
+
+		c.InvalidateName("Test.neofs")
+		_, ok := c.Get(state)
+		require.False(t, ok)
+		_, ok = c.Get(sub)
+		require.False(t, ok)
+		_, ok = c.Get(other)
+		require.True(t, ok)
+	})
+
+	t.Run("soa", func(t *testing.T) {
+		_, ok := c.SOA("neofs.")
+		require.False(t, ok)
+
+		soa := test.SOA("neofs. 300 IN SOA neofs. ops.neofs. 1 3600 600 604800 300")
+		c.AddSOA("neofs.", c.Version(), []string{"neofs"}, soa)
+		res, ok := c.SOA("NEOFS.")
+		require.True(t, ok)
+		require.Equal(t, soa.String(), res.String())
+
+		// SOA query of the apex is cached separately.
+		_, ok = c.Get(newState("neofs.", dns.TypeSOA))
+		require.False(t, ok)
+
+		c.InvalidateName("neofs")
+		_, ok = c.SOA("neofs.")
+		require.False(t, ok)
+
+		c.AddSOA("empty.", c.Version(), []string{"empty"}, nil)
+		res, ok = c.SOA("empty.")
+		require.True(t, ok)
+		require.Nil(t, res)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		c.Add(state, c.Version(), []string{"test.neofs"}, &response{Answer: []dns.RR{test.A("test.neofs. 0 IN A 10.0.0.1")}})
+		now = now.Add(2 * time.Minute)
+		_, ok := c.Get(state)
+		require.False(t, ok)
+	})
+}
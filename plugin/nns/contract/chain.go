@@ -0,0 +1,256 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nspcc-dev/neo-go/pkg/core/state"
+	"github.com/nspcc-dev/neo-go/pkg/neorpc/result"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient/invoker"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient/unwrap"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neo-go/pkg/vm/stackitem"
+	"github.com/nspcc-dev/neofs-contract/nns"
+)
+
+// Chain is the RPC-facing part of the contract: the methods of the contracts invoked in the chain
+// and the chain state. Contracts are identified by the hash, so the same chain serves the views of
+// the contract and the contracts the names are delegated to. ErrFault is returned if the invocation
+// fails (e.g. the domain isn't registered or the contract isn't deployed).
+type Chain interface {
+	// BlockCount returns the number of blocks in the chain.
+	BlockCount() (uint32, error)
+	// GetRecords returns the data of the records of the name and the type.
+	GetRecords(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error)
+	// Resolve returns the data of the records of the name and the type following CNAME records.
+	Resolve(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error)
+	// TraverseAllRecords calls f for every batch of records of the name and its subdomains
+	// until it returns false or all records are traversed.
+	TraverseAllRecords(hash util.Uint160, name string, f func([]Record) bool) error
+	// HasMethod checks whether the contract implements the method with the number of parameters.
+	HasMethod(hash util.Uint160, method string, params int) (bool, error)
+}
+
+// rpcChain invokes the methods via the endpoints of the contract, calls are made
+// in the context and the chain state of the contract view.
+type rpcChain struct {
+	c *Contract
+}
+
+// traverseBatchSize is the number of records requested from the iterator at once.
+const traverseBatchSize = 50
+
+// NewWithChain creates the contract which calls are answered by the chain instead of the endpoints,
+// e.g. from the records in memory. The contract with the hash of prm is the root one.
+func NewWithChain(prm *Params, chain Chain) *Contract {
+	return &Contract{
+		ctx:       context.Background(),
+		hash:      &contractHash{hash: prm.ContractHash},
+		nnsDomain: strings.Trim(prm.Domain, dot),
+		answered:  new(uint32),
+		resolvers: new(sync.Map),
+		names:     newNameIndexes(),
+		calls:     chain,
+	}
+}
+
+// chain returns the chain the methods of the contract are invoked in.
+func (c *Contract) chain() Chain {
+	if c.calls != nil {
+		return c.calls
+	}
+	return rpcChain{c: c}
+}
+
+// BlockCount implements Chain.
+func (r rpcChain) BlockCount() (uint32, error) {
+	var count uint32
+	err := r.c.try(func(cli *rpcclient.Client, _ *invoker.Invoker) error {
+		var err error
+		count, err = cli.GetBlockCount()
+		return err
+	})
+	return count, err
+}
+
+// GetRecords implements Chain.
+func (r rpcChain) GetRecords(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error) {
+	_, res, err := r.call(hash, "getRecords", name, int64(nnsType))
+	arr, err := unwrap.ArrayOfBytes(res, err)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]string, len(arr))
+	for i, rec := range arr {
+		records[i] = string(rec)
+	}
+
+	return records, nil
+}
+
+// Resolve implements Chain.
+func (r rpcChain) Resolve(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error) {
+	_, res, err := r.call(hash, "resolve", name, int64(nnsType))
+	item, err := unwrap.Item(res, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+
+	if _, ok := item.(stackitem.Null); ok {
+		return records, nil
+	}
+
+	arr, ok := item.Value().([]stackitem.Item)
+	if !ok {
+		return nil, errors.New("invalid cast to stack item slice")
+	}
+	for i := range arr {
+		bs, err := arr[i].TryBytes()
+		if err != nil {
+			return nil, fmt.Errorf("convert array item to byte slice: %w", err)
+		}
+
+		records = append(records, string(bs))
+	}
+
+	return records, nil
+}
+
+// TraverseAllRecords implements Chain, records are traversed with the 'getAllRecords' iterator.
+func (r rpcChain) TraverseAllRecords(hash util.Uint160, name string, f func([]Record) bool) error {
+	inv, res, err := r.call(hash, "getAllRecords", name)
+	sessionID, iterator, err := unwrap.SessionIterator(res, err)
+	if err != nil {
+		return err
+	}
+
+	var shouldStop bool
+
+	for !shouldStop {
+		var recordsBatchItems []stackitem.Item
+		err = r.c.await(func(context.Context) error {
+			var err error
+			recordsBatchItems, err = inv.TraverseIterator(sessionID, &iterator, traverseBatchSize)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		recordsBatch, err := getRecordsByItems(recordsBatchItems)
+		if err != nil {
+			return err
+		}
+
+		shouldStop = len(recordsBatch) < traverseBatchSize
+		if !f(recordsBatch) && !shouldStop {
+			// The error doesn't matter, the session expires anyway.
+			_ = inv.TerminateSession(sessionID)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// HasMethod implements Chain, the method is looked up in the contract manifest.
+func (r rpcChain) HasMethod(hash util.Uint160, method string, params int) (bool, error) {
+	var cs *state.Contract
+	err := r.c.try(func(cli *rpcclient.Client, _ *invoker.Invoker) error {
+		var err error
+		cs, err = cli.GetContractStateByHash(hash)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return cs.Manifest.ABI.GetMethod(method, params) != nil, nil
+}
+
+// call invokes the contract method and returns invoker of the endpoint used, so that
+// iterator sessions can be traversed.
+func (r rpcChain) call(hash util.Uint160, method string, params ...interface{}) (*invoker.Invoker, *result.Invoke, error) {
+	var (
+		res     *result.Invoke
+		usedInv *invoker.Invoker
+	)
+	start := time.Now()
+	err := r.c.try(func(_ *rpcclient.Client, inv *invoker.Invoker) error {
+		if hash.Equals(util.Uint160{}) {
+			// The hash of the contract with ID 1 is resolved once the endpoint is connected.
+			hash = r.c.Hash()
+		}
+		var err error
+		res, err = inv.Call(hash, method, params...)
+		usedInv = inv
+		return err
+	})
+	invocationDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		invocations.WithLabelValues(method, outcomeError).Inc()
+		return nil, nil, err
+	}
+	if res.State != haltState {
+		invocations.WithLabelValues(method, outcomeFault).Inc()
+		return nil, nil, fmt.Errorf("%w: %s", ErrFault, res.FaultException)
+	}
+	invocations.WithLabelValues(method, outcomeHalt).Inc()
+
+	return usedInv, res, nil
+}
+
+func getRecordsByItems(items []stackitem.Item) ([]Record, error) {
+	res := make([]Record, len(items))
+	for i, item := range items {
+		structArr, ok := item.Value().([]stackitem.Item)
+		if !ok {
+			return nil, errors.New("bad conversion")
+		}
+		if len(structArr) < 4 {
+			return nil, errors.New("invalid response struct")
+		}
+
+		nameBytes, err := structArr[0].TryBytes()
+		if err != nil {
+			return nil, err
+		}
+		integer, err := structArr[1].TryInteger()
+		if err != nil {
+			return nil, err
+		}
+		typeBytes := integer.Bytes()
+		if len(typeBytes) != 1 {
+			return nil, errors.New("invalid nns type")
+		}
+
+		dataBytes, err := structArr[2].TryBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = Record{
+			Name: string(nameBytes),
+			Type: nns.RecordType(typeBytes[0]),
+			Data: string(dataBytes),
+		}
+
+		// Contracts that store record TTL put it after the record ID.
+		if len(structArr) > 4 {
+			ttl, err := structArr[4].TryInteger()
+			if err == nil && ttl.IsUint64() && ttl.Uint64() <= math.MaxUint32 {
+				res[i].TTL = uint32(ttl.Uint64())
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -5,140 +5,380 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
 	"github.com/nspcc-dev/neo-go/pkg/rpcclient/invoker"
-	"github.com/nspcc-dev/neo-go/pkg/rpcclient/unwrap"
 	"github.com/nspcc-dev/neo-go/pkg/util"
-	"github.com/nspcc-dev/neo-go/pkg/vm/stackitem"
 	"github.com/nspcc-dev/neofs-contract/nns"
 )
 
 type Contract struct {
-	client       *rpcclient.Client
-	invoker      *invoker.Invoker
-	contractHash util.Uint160
-	nnsDomain    string
+	ctx       context.Context
+	endpoints []*endpoint
+	maxFails  uint32
+	// timeout is the timeout of a single call, calls are also abandoned once callCtx is done.
+	timeout time.Duration
+	callCtx context.Context
+
+	// hash is shared with the views of the contract, so the hash resolved on connection is seen by all of them.
+	hash *contractHash
+
+	nnsDomain  string
+	wsEndpoint string
+
+	// answered is set once any endpoint has answered, it's shared with the views of the contract.
+	answered *uint32
+
+	// historic creates the invoker of the past chain state, it's nil for the current state.
+	historic func(*rpcclient.Client) *invoker.Invoker
+
+	// resolvers are the hashes of the contracts known to implement the methods of resolvers,
+	// delegates are set for the contracts of a single request.
+	resolvers *sync.Map
+	delegates *delegates
+
+	// names are the indexes of the names of the domains, they are shared with the views of the contract.
+	names *nameIndexes
+
+	// calls answers the calls instead of the endpoints if it's set, see NewWithChain.
+	calls Chain
 }
 
 type Params struct {
-	Endpoint     string
+	Endpoints    []string
 	ContractHash util.Uint160
 	Domain       string
+	WSEndpoint   string
+	// MaxFails is the number of subsequent failed health checks that are needed
+	// to consider an endpoint down. Zero disables health checking.
+	MaxFails uint32
+	// HealthCheck is the interval of health checks of failed endpoints.
+	HealthCheck time.Duration
+	// Timeout is the timeout of a single call to an endpoint. Zero means that calls are limited
+	// only by the request timeout of the RPC client.
+	Timeout time.Duration
+}
+
+// contractHash is the contract script hash guarded by the mutex.
+type contractHash struct {
+	mtx  sync.RWMutex
+	hash util.Uint160
 }
 
 type Record struct {
 	Name string
 	Type nns.RecordType
 	Data string
+	// TTL is the record TTL if the contract stores it, zero otherwise.
+	TTL uint32
 }
 
-const dot = "."
+const (
+	dot = "."
+
+	// DefaultMaxFails is the default number of failed health checks to consider an endpoint down.
+	DefaultMaxFails = 2
+	// DefaultHealthCheck is the default interval of health checks.
+	DefaultHealthCheck = 500 * time.Millisecond
+	// DefaultTimeout is the default timeout of a single call.
+	DefaultTimeout = 5 * time.Second
+)
+
+const haltState = "HALT"
+
+var (
+	errInvalidContract = errors.New("invalid contract")
+	errNoEndpoints     = errors.New("no endpoints")
+)
 
+// ErrFault is returned when the contract invocation ends in FAULT state,
+// e.g. when the requested domain isn't registered.
+var ErrFault = errors.New("invocation failed")
+
+// NewContract creates a contract and tries to connect to all its endpoints. Unreachable
+// endpoints don't fail the creation, they are connected lazily later.
 func NewContract(ctx context.Context, prm *Params) (*Contract, error) {
-	cli, err := rpcclient.New(ctx, prm.Endpoint, rpcclient.Options{})
-	if err != nil {
-		return nil, err
+	if len(prm.Endpoints) == 0 {
+		return nil, errNoEndpoints
 	}
-	if err = cli.Init(); err != nil {
-		return nil, err
+
+	c := &Contract{
+		ctx:        ctx,
+		maxFails:   prm.MaxFails,
+		timeout:    prm.Timeout,
+		hash:       &contractHash{hash: prm.ContractHash},
+		nnsDomain:  strings.Trim(prm.Domain, dot),
+		wsEndpoint: prm.WSEndpoint,
+		answered:   new(uint32),
+		resolvers:  new(sync.Map),
+		names:      newNameIndexes(),
+	}
+
+	for _, addr := range prm.Endpoints {
+		e := newEndpoint(ctx, addr, c.checkContract)
+		e.timeout = prm.Timeout
+		e.probe.Start(prm.HealthCheck)
+		c.endpoints = append(c.endpoints, e)
 	}
 
-	if prm.ContractHash.Equals(util.Uint160{}) {
+	for _, e := range c.endpoints {
+		if _, _, err := e.connect(ctx); err != nil {
+			if errors.Is(err, errInvalidContract) {
+				c.Close()
+				return nil, err
+			}
+			if c.maxFails != 0 {
+				e.Healthcheck(ctx)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// checkContract makes sure the contract is deployed in the chain of the newly connected client.
+// If contract hash isn't set, the contract with ID 1 is used.
+func (c *Contract) checkContract(cli *rpcclient.Client) error {
+	hash := c.Hash()
+	if hash.Equals(util.Uint160{}) {
 		cs, err := cli.GetContractStateByID(1)
 		if err != nil {
-			return nil, fmt.Errorf("get contract by id 1: %w", err)
+			return fmt.Errorf("%w: get contract by id 1: %s", errInvalidContract, err)
 		}
-		prm.ContractHash = cs.Hash
-	} else {
-		if _, err = cli.GetContractStateByHash(prm.ContractHash); err != nil {
-			return nil, fmt.Errorf("get contract '%s': %w", prm.ContractHash.StringLE(), err)
+		c.hash.mtx.Lock()
+		if c.hash.hash.Equals(util.Uint160{}) {
+			c.hash.hash = cs.Hash
 		}
+		c.hash.mtx.Unlock()
+		return nil
+	}
+
+	if _, err := cli.GetContractStateByHash(hash); err != nil {
+		return fmt.Errorf("%w: get contract '%s': %s", errInvalidContract, hash.StringLE(), err)
 	}
+	return nil
+}
 
-	return &Contract{
-		client:       cli,
-		invoker:      invoker.New(cli, nil),
-		contractHash: prm.ContractHash,
-		nnsDomain:    strings.Trim(prm.Domain, dot),
-	}, nil
+// Close stops health checking and closes the clients.
+func (c *Contract) Close() {
+	for _, e := range c.endpoints {
+		e.stop()
+	}
 }
 
-func (c Contract) Hash() util.Uint160 {
-	return c.contractHash
+// Hash returns the contract script hash. It's empty if the contract with ID 1
+// is used and none of the endpoints has been connected yet.
+func (c *Contract) Hash() util.Uint160 {
+	c.hash.mtx.RLock()
+	defer c.hash.mtx.RUnlock()
+	return c.hash.hash
 }
 
-func (c *Contract) Resolve(name string, nnsType nns.RecordType) ([]string, error) {
-	item, err := unwrap.Item(c.invoker.Call(c.contractHash, "resolve", name, int64(nnsType)))
-	if err != nil {
-		return nil, err
+// healthy returns endpoints in the configured order, the ones that are down are skipped.
+// If all of them are down, health checking is assumed to be broken and all endpoints are returned.
+func (c *Contract) healthy() []*endpoint {
+	res := make([]*endpoint, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		if !e.Down(c.maxFails) {
+			res = append(res, e)
+		}
 	}
+	if len(res) == 0 {
+		return c.endpoints
+	}
+	return res
+}
 
-	var res []string
+// try calls f with the client of the first healthy endpoint, the next endpoints are tried if it fails.
+// Failed endpoints are health checked.
+func (c *Contract) try(f func(*rpcclient.Client, *invoker.Invoker) error) error {
+	if len(c.endpoints) == 0 {
+		return errNoEndpoints
+	}
 
-	if _, ok := item.(stackitem.Null); ok {
-		return res, nil
+	var lastErr error
+	for _, e := range c.healthy() {
+		// Connection is awaited the same way as the call, so unreachable endpoints don't block the request.
+		err := c.await(func(ctx context.Context) error {
+			cli, inv, err := e.connect(ctx)
+			if err != nil {
+				return err
+			}
+			if c.historic != nil {
+				inv = c.historic(cli)
+			}
+			return f(cli, inv)
+		})
+		if err == nil {
+			atomic.StoreUint32(c.answered, 1)
+			return nil
+		}
+
+		lastErr = fmt.Errorf("endpoint '%s': %w", e.addr, err)
+		if c.callCtx != nil && c.callCtx.Err() != nil {
+			// The request is done, so there is no point in trying other endpoints.
+			return lastErr
+		}
+		if c.maxFails != 0 {
+			e.Healthcheck(c.ctx)
+		}
 	}
 
-	arr, ok := item.Value().([]stackitem.Item)
-	if !ok {
-		return nil, errors.New("invalid cast to stack item slice")
+	return lastErr
+}
+
+// await runs f and waits until it returns, the call timeout passes or the call context is done.
+// In the latter cases f keeps running in background until the request to the node times out.
+// f gets the context of the call.
+func (c *Contract) await(f func(context.Context) error) error {
+	ctx := c.callCtx
+	if ctx == nil {
+		ctx = c.ctx
 	}
-	for i := range arr {
-		bs, err := arr[i].TryBytes()
-		if err != nil {
-			return nil, fmt.Errorf("convert array item to byte slice: %w", err)
-		}
+	if c.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f(ctx)
+	}()
 
-		res = append(res, string(bs))
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	return res, nil
+// WithContext returns the contract which calls are abandoned once ctx is done.
+// It's used for a single request, so delegates of the names are looked up once.
+func (c *Contract) WithContext(ctx context.Context) *Contract {
+	v := c.view(c.hash, c.historic)
+	v.callCtx = ctx
+	v.delegates = newDelegates()
+	return v
+}
+
+// Answered checks whether any endpoint has answered since the contract was created.
+func (c *Contract) Answered() bool {
+	return atomic.LoadUint32(c.answered) != 0
+}
+
+// ObserveChain updates the block height and chain lag metrics of all the endpoints.
+func (c *Contract) ObserveChain() {
+	for _, e := range c.endpoints {
+		if err := e.observe(c.ctx); err == nil {
+			atomic.StoreUint32(c.answered, 1)
+		}
+	}
+}
+
+// BlockCount returns the number of blocks in the chain the contract is deployed to.
+func (c *Contract) BlockCount() (uint32, error) {
+	return c.chain().BlockCount()
+}
+
+// Resolve returns the data of the records of the name and the type, CNAME records are followed by the contract.
+func (c *Contract) Resolve(name string, nnsType nns.RecordType) ([]string, error) {
+	return c.chain().Resolve(c.Hash(), name, nnsType)
 }
 
 func (c *Contract) GetAllRecords(name string) ([]Record, error) {
-	sessionID, iterator, err := unwrap.SessionIterator(c.invoker.Call(c.contractHash, "getAllRecords", name))
+	var records []Record
+	err := c.traverseAllRecords(name, func(batch []Record) bool {
+		records = append(records, batch...)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var records []Record
-	var shouldStop bool
-	batchSize := 50
+	return records, nil
+}
 
-	for !shouldStop {
-		recordsBatchItems, err := c.invoker.TraverseIterator(sessionID, &iterator, batchSize)
-		if err != nil {
-			return nil, err
-		}
+// NameExists checks whether there are records of the name or of its subdomains (so the name
+// is an empty non-terminal). Names of unregistered domains don't exist.
+func (c *Contract) NameExists(name string) (bool, error) {
+	exists, err := c.NamesExist([]string{name})
+	if err != nil {
+		return false, err
+	}
+	return exists[0], nil
+}
 
-		recordsBatch, err := getRecordsByItems(recordsBatchItems)
-		if err != nil {
-			return nil, err
-		}
+// NamesExist checks whether the names exist (see NameExists). Names are looked up in the index
+// of their domains, so the records of the domain are traversed at most once per block.
+func (c *Contract) NamesExist(names []string) ([]bool, error) {
+	height, err := c.height()
+	if err != nil {
+		return nil, err
+	}
 
-		records = append(records, recordsBatch...)
-		shouldStop = len(recordsBatch) < batchSize
+	res := make([]bool, len(names))
+	indexes := make(map[string]*nameIndex)
+	for i, name := range names {
+		domain := strings.ToLower(tokenName(name))
+		idx, ok := indexes[domain]
+		if !ok {
+			idx, err = c.index(domain, height)
+			if err != nil && !errors.Is(err, ErrFault) {
+				return nil, err
+			}
+			indexes[domain] = idx
+		}
+		if idx != nil {
+			_, res[i] = idx.types[strings.ToLower(name)]
+		}
 	}
 
-	return records, nil
+	return res, nil
 }
 
-func (c *Contract) GetRecords(name string, nnsType nns.RecordType) ([]string, error) {
-	res, err := unwrap.ArrayOfBytes(c.invoker.Call(c.contractHash, "getRecords", name, int64(nnsType)))
+// Types returns types of the records of the name (not including its subdomains).
+// There are no types for names of unregistered domains.
+func (c *Contract) Types(name string) ([]nns.RecordType, error) {
+	height, err := c.height()
 	if err != nil {
 		return nil, err
 	}
 
-	records := make([]string, len(res))
-	for i, rec := range res {
-		records[i] = string(rec)
+	idx, err := c.index(name, height)
+	if errors.Is(err, ErrFault) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return records, nil
+	types := idx.types[strings.ToLower(name)]
+	return append([]nns.RecordType(nil), types...), nil
+}
+
+// TraverseAllRecords calls f for every batch of records of the name and its subdomains until it returns
+// false or all records are traversed. Records aren't kept in memory, so large zones can be streamed.
+func (c *Contract) TraverseAllRecords(name string, f func([]Record) bool) error {
+	return c.traverseAllRecords(name, f)
+}
+
+// traverseAllRecords calls f for every batch of records returned by 'getAllRecords'
+// until it returns false or all records are traversed.
+func (c *Contract) traverseAllRecords(name string, f func([]Record) bool) error {
+	return c.chain().TraverseAllRecords(c.Hash(), name, f)
 }
 
-func (c Contract) PrepareName(name, dnsDomain string) string {
+// GetRecords returns the data of the records of the name and the type.
+func (c *Contract) GetRecords(name string, nnsType nns.RecordType) ([]string, error) {
+	return c.chain().GetRecords(c.Hash(), name, nnsType)
+}
+
+func (c *Contract) PrepareName(name, dnsDomain string) string {
 	name = strings.TrimSuffix(name, dot)
 	if c.nnsDomain != "" {
 		name = strings.TrimSuffix(strings.TrimSuffix(name, dnsDomain), dot)
@@ -150,41 +390,40 @@ func (c Contract) PrepareName(name, dnsDomain string) string {
 	return name
 }
 
-func getRecordsByItems(items []stackitem.Item) ([]Record, error) {
-	res := make([]Record, len(items))
-	for i, item := range items {
-		structArr, ok := item.Value().([]stackitem.Item)
-		if !ok {
-			return nil, errors.New("bad conversion")
-		}
-		if len(structArr) != 4 {
-			return nil, errors.New("invalid response struct")
-		}
-
-		nameBytes, err := structArr[0].TryBytes()
-		if err != nil {
-			return nil, err
-		}
-		integer, err := structArr[1].TryInteger()
-		if err != nil {
-			return nil, err
-		}
-		typeBytes := integer.Bytes()
-		if len(typeBytes) != 1 {
-			return nil, errors.New("invalid nns type")
-		}
+// Domain returns the NNS domain names are mapped to.
+func (c *Contract) Domain() string {
+	return c.nnsDomain
+}
 
-		dataBytes, err := structArr[2].TryBytes()
-		if err != nil {
-			return nil, err
-		}
+// WithDomain returns the contract which names are mapped to the NNS domain.
+func (c *Contract) WithDomain(nnsDomain string) *Contract {
+	v := c.view(c.hash, c.historic)
+	v.nnsDomain = strings.Trim(nnsDomain, dot)
+	v.delegates = c.delegates
+	return v
+}
 
-		res[i] = Record{
-			Name: string(nameBytes),
-			Type: nns.RecordType(typeBytes[0]),
-			Data: string(dataBytes),
+// DNSName maps the name in the contract back to the DNS name, it's the inverse of PrepareName.
+func (c *Contract) DNSName(name, dnsDomain string) string {
+	name = strings.TrimSuffix(name, dot)
+	if c.nnsDomain != "" && (name == c.nnsDomain || strings.HasSuffix(name, dot+c.nnsDomain)) {
+		name = strings.TrimSuffix(strings.TrimSuffix(name, c.nnsDomain), dot)
+		if dnsDomain != "" {
+			if name != "" {
+				name += dot
+			}
+			name += dnsDomain
 		}
 	}
+	return name + dot
+}
 
-	return res, nil
+// tokenName returns the name of the token (the second-level domain) the name belongs to,
+// records of all names of the token are returned by 'getAllRecords'.
+func tokenName(name string) string {
+	labels := strings.Split(name, dot)
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, dot)
 }
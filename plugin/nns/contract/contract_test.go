@@ -0,0 +1,221 @@
+package contract
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neofs-contract/nns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSName(t *testing.T) {
+	for _, tc := range []struct {
+		nnsDomain, dnsDomain, name, nnsName string
+	}{
+		{name: "a.neofs.", nnsName: "a.neofs"},
+		{nnsDomain: "containers", dnsDomain: "containers.testnet.fs.neo.org", name: "a.containers.testnet.fs.neo.org.", nnsName: "a.containers"},
+		{nnsDomain: "containers", dnsDomain: "containers.testnet.fs.neo.org", name: "containers.testnet.fs.neo.org.", nnsName: "containers"},
+		{nnsDomain: "containers", name: "a.", nnsName: "a.containers"},
+	} {
+		c := &Contract{nnsDomain: tc.nnsDomain}
+		require.Equal(t, tc.nnsName, c.PrepareName(tc.name, tc.dnsDomain))
+		require.Equal(t, tc.name, c.DNSName(tc.nnsName, tc.dnsDomain))
+	}
+
+	c := &Contract{nnsDomain: "containers"}
+	require.Equal(t, "other.", c.DNSName("other", "containers.testnet.fs.neo.org"))
+}
+
+func TestViews(t *testing.T) {
+	c := &Contract{hash: &contractHash{}, answered: new(uint32)}
+	v := c.WithContext(context.Background()).WithDomain("containers").AtHeight(10)
+
+	// The hash of the contract with ID 1 is resolved once an endpoint is connected.
+	c.hash.hash = util.Uint160{1}
+	require.Equal(t, c.Hash(), v.Hash())
+
+	atomic.StoreUint32(v.answered, 1)
+	require.True(t, c.Answered())
+
+	d := v.view(&contractHash{hash: util.Uint160{2}}, v.historic)
+	require.Equal(t, util.Uint160{2}, d.Hash())
+	require.Equal(t, util.Uint160{1}, c.Hash())
+}
+
+func TestNamesExist(t *testing.T) {
+	hash := util.Uint160{1}
+	c := NewWithChain(&Params{ContractHash: hash}, newMemChain(map[util.Uint160][]Record{hash: {
+		{Name: "a.b.example.neofs", Type: nns.A, Data: "10.0.0.1"},
+		{Name: "other.neofs", Type: nns.A, Data: "10.0.0.2"},
+	}}))
+
+	exists, err := c.NamesExist([]string{"a.b.example.neofs", "B.example.neofs", "c.example.neofs", "other.neofs", "unknown.neofs"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, true, false, true, false}, exists)
+
+	exists, err = c.NamesExist([]string{"example.neofs"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true}, exists)
+}
+
+func TestNameIndex(t *testing.T) {
+	hash := util.Uint160{1}
+	chain := newMemChain(map[util.Uint160][]Record{hash: {
+		{Name: "a.example.neofs", Type: nns.A, Data: "10.0.0.1"},
+		{Name: "a.example.neofs", Type: nns.TXT, Data: "text"},
+		{Name: "a.example.neofs", Type: nns.A, Data: "10.0.0.2"},
+	}})
+	c := NewWithChain(&Params{ContractHash: hash}, chain)
+
+	types, err := c.Types("A.example.neofs")
+	require.NoError(t, err)
+	require.Equal(t, []nns.RecordType{nns.A, nns.TXT}, types)
+
+	// The records aren't traversed again until the chain grows.
+	chain.records[hash] = []Record{{Name: "b.example.neofs", Type: nns.AAAA, Data: "::1"}}
+	exists, err := c.WithContext(context.Background()).NamesExist([]string{"a.example.neofs", "b.example.neofs"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, false}, exists)
+
+	chain.SetRecords(hash, chain.records[hash])
+	exists, err = c.NamesExist([]string{"a.example.neofs", "b.example.neofs"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true}, exists)
+
+	types, err = c.Types("example.neofs")
+	require.NoError(t, err)
+	require.Empty(t, types)
+
+	types, err = c.Types("a.unknown.neofs")
+	require.NoError(t, err)
+	require.Empty(t, types)
+}
+
+func TestResolve(t *testing.T) {
+	hash := util.Uint160{1}
+	c := NewWithChain(&Params{ContractHash: hash}, newMemChain(map[util.Uint160][]Record{hash: {
+		{Name: "a.example.neofs", Type: nns.CNAME, Data: "b.example.neofs"},
+		{Name: "b.example.neofs", Type: nns.A, Data: "10.0.0.1"},
+	}}))
+
+	records, err := c.Resolve("a.example.neofs", nns.A)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b.example.neofs", "10.0.0.1"}, records)
+
+	records, err = c.Resolve("b.example.neofs", nns.TXT)
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	_, err = c.Resolve("a.unknown.neofs", nns.A)
+	require.ErrorIs(t, err, ErrFault)
+}
+
+// memChain answers the calls from the records of the contracts in memory. Like in the contract, the domain
+// is registered if there are records of it or its subdomains. Contracts with nil records are the ones that
+// implement only 'resolve' method.
+type memChain struct {
+	mtx     sync.RWMutex
+	height  uint32
+	records map[util.Uint160][]Record
+}
+
+func newMemChain(records map[util.Uint160][]Record) *memChain {
+	return &memChain{height: 1, records: records}
+}
+
+// SetRecords replaces the records of the contract with the hash and persists a new block.
+func (m *memChain) SetRecords(hash util.Uint160, records []Record) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.records[hash] = records
+	m.height++
+}
+
+func (m *memChain) BlockCount() (uint32, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.height, nil
+}
+
+func (m *memChain) GetRecords(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error) {
+	records, err := m.domainRecords(hash, name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for _, rec := range records {
+		if rec.Type == nnsType && strings.EqualFold(rec.Name, name) {
+			res = append(res, rec.Data)
+		}
+	}
+	return res, nil
+}
+
+// Resolve returns the records of the type or follows the CNAME record like the contract does.
+func (m *memChain) Resolve(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error) {
+	res, err := m.GetRecords(hash, name, nnsType)
+	if err != nil || len(res) != 0 || nnsType == nns.CNAME {
+		return res, err
+	}
+
+	cnames, err := m.GetRecords(hash, name, nns.CNAME)
+	if err != nil || len(cnames) == 0 {
+		return nil, err
+	}
+	res, err = m.Resolve(hash, cnames[0], nnsType)
+	if err != nil {
+		return nil, err
+	}
+	return append(cnames[:1], res...), nil
+}
+
+func (m *memChain) TraverseAllRecords(hash util.Uint160, name string, f func([]Record) bool) error {
+	records, err := m.domainRecords(hash, name)
+	if err != nil {
+		return err
+	}
+	f(records)
+	return nil
+}
+
+func (m *memChain) HasMethod(hash util.Uint160, _ string, _ int) (bool, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	records, ok := m.records[hash]
+	if !ok {
+		return false, fmt.Errorf("%w: contract '%s' isn't deployed", ErrFault, hash.StringLE())
+	}
+	return records != nil, nil
+}
+
+// domainRecords returns the records of the second-level domain of the name.
+func (m *memChain) domainRecords(hash util.Uint160, name string) ([]Record, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	records, ok := m.records[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: contract '%s' isn't deployed", ErrFault, hash.StringLE())
+	}
+	if records == nil {
+		return nil, fmt.Errorf("%w: method not found", ErrFault)
+	}
+
+	token := tokenName(name)
+	var res []Record
+	for _, rec := range records {
+		if strings.EqualFold(tokenName(rec.Name), token) {
+			res = append(res, rec)
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%w: domain '%s' isn't registered", ErrFault, token)
+	}
+	return res, nil
+}
@@ -0,0 +1,174 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/up"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient/invoker"
+)
+
+// endpoint is a neo node RPC endpoint. It connects lazily on first use,
+// failed calls kick off health checking the same way plugin/forward does.
+type endpoint struct {
+	fails uint32
+	// ctx is the context of the client, the client is closed once it's done.
+	ctx  context.Context
+	addr string
+	// timeout is the timeout of requests to the node.
+	timeout time.Duration
+
+	mtx     sync.Mutex
+	client  *rpcclient.Client
+	invoker *invoker.Invoker
+	// dialing is the connection in progress, nil if there is none.
+	dialing *dial
+	stopped bool
+
+	// onConnect is called once a new client is initialized.
+	onConnect func(*rpcclient.Client) error
+
+	probe *up.Probe
+}
+
+// dial is the connection to the node, err is set once done is closed.
+type dial struct {
+	done chan struct{}
+	err  error
+}
+
+func newEndpoint(ctx context.Context, addr string, onConnect func(*rpcclient.Client) error) *endpoint {
+	return &endpoint{
+		ctx:       ctx,
+		addr:      addr,
+		onConnect: onConnect,
+		probe:     up.New(),
+	}
+}
+
+// connect returns initialized client and invoker, it connects to the node if it's not done yet.
+// The node is dialed in background once for all the callers, ctx limits only the wait for it.
+func (e *endpoint) connect(ctx context.Context) (*rpcclient.Client, *invoker.Invoker, error) {
+	e.mtx.Lock()
+	if e.client != nil {
+		defer e.mtx.Unlock()
+		return e.client, e.invoker, nil
+	}
+	d := e.dialing
+	if d == nil {
+		d = &dial{done: make(chan struct{})}
+		e.dialing = d
+		go e.dial(d)
+	}
+	e.mtx.Unlock()
+
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.client, e.invoker, nil
+}
+
+// dial connects to the node and initializes the client, it doesn't hold the mutex during the requests.
+func (e *endpoint) dial(d *dial) {
+	cli, err := rpcclient.New(e.ctx, e.addr, rpcclient.Options{DialTimeout: e.timeout, RequestTimeout: e.timeout})
+	if err == nil {
+		if err = cli.Init(); err == nil && e.onConnect != nil {
+			err = e.onConnect(cli)
+		}
+		if err != nil {
+			cli.Close()
+		}
+	}
+
+	e.mtx.Lock()
+	if err == nil && e.stopped {
+		cli.Close()
+		err = errors.New("endpoint is stopped")
+	}
+	if err == nil {
+		e.client = cli
+		e.invoker = invoker.New(cli, nil)
+	}
+	e.dialing = nil
+	d.err = err
+	e.mtx.Unlock()
+	close(d.done)
+}
+
+// Check connects to the node and requests its block count, it's used as the up.Func in the up.Probe.
+func (e *endpoint) Check(ctx context.Context) error {
+	cli, _, err := e.connect(ctx)
+	if err == nil {
+		_, err = cli.GetBlockCount()
+	}
+	if err != nil {
+		atomic.AddUint32(&e.fails, 1)
+		return err
+	}
+
+	atomic.StoreUint32(&e.fails, 0)
+	return nil
+}
+
+// observe updates the block height and chain lag metrics of the endpoint.
+func (e *endpoint) observe(ctx context.Context) error {
+	cli, _, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	count, err := cli.GetBlockCount()
+	if err != nil || count == 0 {
+		return err
+	}
+	header, err := cli.GetBlockHeaderByIndex(count - 1)
+	if err != nil {
+		return err
+	}
+
+	blockHeight.WithLabelValues(e.addr).Set(float64(count - 1))
+	// Block timestamp is in milliseconds.
+	created := time.Unix(0, int64(header.Timestamp)*int64(time.Millisecond))
+	chainLag.WithLabelValues(e.addr).Set(time.Since(created).Seconds())
+	return nil
+}
+
+// Healthcheck kicks off a round of health checks for this endpoint.
+func (e *endpoint) Healthcheck(ctx context.Context) {
+	e.probe.Do(func() error {
+		return e.Check(ctx)
+	})
+}
+
+// Down returns true if this endpoint is down, i.e. has *more* fails than maxfails.
+func (e *endpoint) Down(maxfails uint32) bool {
+	if maxfails == 0 {
+		return false
+	}
+
+	fails := atomic.LoadUint32(&e.fails)
+	return fails > maxfails
+}
+
+// stop stops the health checking and closes the client.
+func (e *endpoint) stop() {
+	e.probe.Stop()
+
+	e.mtx.Lock()
+	e.stopped = true
+	if e.client != nil {
+		e.client.Close()
+	}
+	e.mtx.Unlock()
+}
@@ -0,0 +1,76 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthy(t *testing.T) {
+	c := &Contract{
+		maxFails:  2,
+		endpoints: []*endpoint{newEndpoint(context.Background(), "http://localhost:30333", nil), newEndpoint(context.Background(), "http://localhost:30334", nil)},
+	}
+	require.Equal(t, c.endpoints, c.healthy())
+
+	c.endpoints[0].fails = 2
+	require.Equal(t, c.endpoints, c.healthy())
+
+	c.endpoints[0].fails = 3
+	require.Equal(t, c.endpoints[1:], c.healthy())
+
+	// all endpoints are down, health checking is assumed to be broken
+	c.endpoints[1].fails = 3
+	require.Equal(t, c.endpoints, c.healthy())
+
+	// health checking is disabled
+	c.endpoints[1].fails = 0
+	c.maxFails = 0
+	require.Equal(t, c.endpoints, c.healthy())
+}
+
+func TestAwait(t *testing.T) {
+	c := &Contract{ctx: context.Background(), timeout: 10 * time.Millisecond}
+
+	require.NoError(t, c.await(func(context.Context) error { return nil }))
+	require.ErrorIs(t, c.await(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}), context.DeadlineExceeded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = c.WithContext(ctx)
+	require.ErrorIs(t, c.await(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}), context.Canceled)
+}
+
+func TestConnect(t *testing.T) {
+	// The node hangs during the connection.
+	release := make(chan struct{})
+	e := newEndpoint(context.Background(), "http://localhost:1", func(*rpcclient.Client) error {
+		<-release
+		return errors.New("unreachable")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := e.connect(ctx)
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// The mutex isn't held during the connection.
+	e.mtx.Lock()
+	e.mtx.Unlock()
+
+	close(release)
+	_, _, err = e.connect(context.Background())
+	require.Error(t, err)
+}
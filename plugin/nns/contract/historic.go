@@ -0,0 +1,55 @@
+package contract
+
+import (
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient/invoker"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+)
+
+// AtHeight returns the contract which methods are invoked against the chain state
+// after the block with the index is persisted. The node must keep the old states
+// (RemoveUntraceableBlocks disabled or the height within MaxTraceableBlocks).
+func (c *Contract) AtHeight(height uint32) *Contract {
+	return c.withHistoric(func(cli *rpcclient.Client) *invoker.Invoker {
+		return invoker.NewHistoricAtHeight(height, cli, nil)
+	})
+}
+
+// AtState returns the contract which methods are invoked against the chain state
+// with the state root or after the block with the hash is persisted.
+func (c *Contract) AtState(rootOrBlock util.Uint256) *Contract {
+	return c.withHistoric(func(cli *rpcclient.Client) *invoker.Invoker {
+		return invoker.NewHistoricWithState(rootOrBlock, cli, nil)
+	})
+}
+
+// withHistoric returns the contract sharing the endpoints with c that uses the invokers
+// of the historic state. Endpoints are health checked as usual.
+func (c *Contract) withHistoric(historic func(*rpcclient.Client) *invoker.Invoker) *Contract {
+	v := c.view(c.hash, historic)
+	if c.delegates != nil {
+		// Names can be delegated to other contracts in the historic state.
+		v.delegates = newDelegates()
+	}
+	return v
+}
+
+// view returns the contract with the hash sharing the endpoints, the answered flag, the known resolvers
+// and the name indexes with c.
+func (c *Contract) view(hash *contractHash, historic func(*rpcclient.Client) *invoker.Invoker) *Contract {
+	return &Contract{
+		ctx:        c.ctx,
+		endpoints:  c.endpoints,
+		maxFails:   c.maxFails,
+		timeout:    c.timeout,
+		callCtx:    c.callCtx,
+		hash:       hash,
+		nnsDomain:  c.nnsDomain,
+		wsEndpoint: c.wsEndpoint,
+		answered:   c.answered,
+		resolvers:  c.resolvers,
+		names:      c.names,
+		historic:   historic,
+		calls:      c.calls,
+	}
+}
@@ -0,0 +1,48 @@
+package contract
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const subsystem = "nns"
+
+var (
+	// invocations is a counter of contract invocations by method and outcome.
+	invocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "invocations_total",
+		Help:      "Counter of nns contract invocations.",
+	}, []string{"method", "outcome"})
+	// invocationDuration is a histogram of contract invocation durations by method.
+	invocationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "invocation_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time each nns contract invocation took.",
+	}, []string{"method"})
+	// blockHeight is the last seen block height of the endpoint.
+	blockHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "block_height",
+		Help:      "The last seen block height of the endpoint.",
+	}, []string{"endpoint"})
+	// chainLag is the time since the last block of the endpoint was created.
+	chainLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: subsystem,
+		Name:      "chain_lag_seconds",
+		Help:      "The time since the last seen block of the endpoint was created.",
+	}, []string{"endpoint"})
+)
+
+const (
+	outcomeHalt  = "halt"
+	outcomeFault = "fault"
+	outcomeError = "error"
+)
@@ -0,0 +1,160 @@
+package contract
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/nspcc-dev/neofs-contract/nns"
+)
+
+// nameIndexCap is the number of domains which names are indexed at once.
+const nameIndexCap = 100
+
+// nameIndexes keeps the indexes of the names of the domains at the current chain state, they are shared
+// by the views of the contract.
+type nameIndexes struct {
+	mtx   sync.Mutex
+	items *cache.Cache
+}
+
+// nameIndex is the set of names of the domain (including empty non-terminals) with the types of their
+// records. It's built by a single traversal of the domain records at the block height and is used
+// by all the requests until the chain grows.
+type nameIndex struct {
+	height uint32
+	// done is closed once the index is built, types must not be accessed before.
+	done  chan struct{}
+	types map[string][]nns.RecordType
+	err   error
+}
+
+func newNameIndexes() *nameIndexes {
+	return &nameIndexes{items: cache.New(nameIndexCap)}
+}
+
+// get returns the index of the domain built at the height or later. If there is none,
+// the new index is stored and true is returned, the caller must build it.
+func (n *nameIndexes) get(key uint64, height uint32) (*nameIndex, bool) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if el, ok := n.items.Get(key); ok && el.(*nameIndex).height >= height {
+		return el.(*nameIndex), false
+	}
+
+	idx := &nameIndex{height: height, done: make(chan struct{})}
+	n.items.Add(key, idx)
+	return idx, true
+}
+
+// remove removes the index of the domain if it's still stored.
+func (n *nameIndexes) remove(key uint64, idx *nameIndex) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if el, ok := n.items.Get(key); ok && el.(*nameIndex) == idx {
+		n.items.Remove(key)
+	}
+}
+
+// index returns the index of the names of the domain the name belongs to at the height. Indexes of
+// the current state are built once per block, the concurrent requests wait for the one being built.
+// Names of historic states are indexed for every call. ErrFault is returned if the domain isn't registered.
+func (c *Contract) index(name string, height uint32) (*nameIndex, error) {
+	domain := strings.ToLower(tokenName(name))
+	if c.historic != nil {
+		return c.buildIndex(domain, height)
+	}
+
+	ctx := c.callCtx
+	if ctx == nil {
+		ctx = c.ctx
+	}
+
+	key := cache.Hash([]byte(c.Hash().StringLE() + "/" + domain))
+	for {
+		idx, build := c.names.get(key, height)
+		if build {
+			built, err := c.buildIndex(domain, height)
+			if err != nil {
+				// Failed traversals aren't cached, so unregistered domains don't evict the registered ones.
+				c.names.remove(key, idx)
+				idx.err = err
+			} else {
+				idx.types = built.types
+			}
+			close(idx.done)
+			return idx, err
+		}
+
+		select {
+		case <-idx.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if idx.err == nil {
+			return idx, nil
+		}
+		if errors.Is(idx.err, ErrFault) {
+			return nil, idx.err
+		}
+		// The request that was building the index has failed, it's built again.
+	}
+}
+
+// buildIndex traverses the records of the domain and indexes their names.
+func (c *Contract) buildIndex(domain string, height uint32) (*nameIndex, error) {
+	idx := &nameIndex{height: height, types: make(map[string][]nns.RecordType)}
+	err := c.traverseAllRecords(domain, func(batch []Record) bool {
+		for _, rec := range batch {
+			name := strings.ToLower(rec.Name)
+			types, ok := idx.types[name]
+			if !ok {
+				idx.addAncestors(name, domain)
+			}
+			if !hasType(types, rec.Type) {
+				idx.types[name] = append(types, rec.Type)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// addAncestors adds the names between the name and the domain as empty non-terminals.
+func (idx *nameIndex) addAncestors(name, domain string) {
+	for name != domain {
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return
+		}
+		name = name[i+1:]
+		if _, ok := idx.types[name]; ok {
+			// The ancestors of the name are already added.
+			return
+		}
+		idx.types[name] = nil
+	}
+}
+
+// height returns the block height names are indexed at, it's zero for historic states.
+func (c *Contract) height() (uint32, error) {
+	if c.historic != nil {
+		return 0, nil
+	}
+	return c.BlockCount()
+}
+
+func hasType(types []nns.RecordType, t nns.RecordType) bool {
+	for _, other := range types {
+		if other == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nspcc-dev/neo-go/pkg/core/state"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neo-go/pkg/vm/stackitem"
+)
+
+// Notification is an event emitted by the NNS contract.
+type Notification struct {
+	Event string
+	// Name is a domain affected by the event. It's empty if the domain can't be determined.
+	Name string
+}
+
+const transferEvent = "Transfer"
+
+// WSEndpoint returns WebSocket RPC endpoint to receive the contract notifications from.
+// It's empty if notifications are not used.
+func (c *Contract) WSEndpoint() string {
+	return c.wsEndpoint
+}
+
+// Subscribe connects to the WebSocket RPC endpoint and subscribes to the contract notifications.
+// The returned channel is closed when the connection is lost or ctx is done.
+func (c *Contract) Subscribe(ctx context.Context) (<-chan Notification, error) {
+	hash := c.Hash()
+	if hash.Equals(util.Uint160{}) {
+		return nil, errors.New("contract hash is unknown, no endpoints have been connected yet")
+	}
+
+	ws, err := rpcclient.NewWS(ctx, c.wsEndpoint, rpcclient.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = ws.SubscribeForExecutionNotifications(&hash, nil); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("subscribe for notifications of '%s': %w", hash.StringLE(), err)
+	}
+
+	ch := make(chan Notification)
+	go func() {
+		defer close(ch)
+		defer ws.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ntf, ok := <-ws.Notifications:
+				if !ok {
+					return
+				}
+				event, ok := ntf.Value.(*state.ContainedNotificationEvent)
+				if !ok {
+					continue
+				}
+
+				select {
+				case ch <- notificationFromEvent(&event.NotificationEvent):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// notificationFromEvent determines domain affected by the event. NEP-11 'Transfer' event
+// has domain as the token ID (the last parameter), other NNS events have it as the first one.
+func notificationFromEvent(event *state.NotificationEvent) Notification {
+	res := Notification{Event: event.Name}
+	if event.Item == nil {
+		return res
+	}
+
+	params, ok := event.Item.Value().([]stackitem.Item)
+	if !ok || len(params) == 0 {
+		return res
+	}
+
+	param := params[0]
+	if event.Name == transferEvent {
+		param = params[len(params)-1]
+	}
+
+	bs, err := param.TryBytes()
+	if err != nil || !isDomainName(bs) {
+		return res
+	}
+	res.Name = strings.ToLower(string(bs))
+
+	return res
+}
+
+func isDomainName(bs []byte) bool {
+	if len(bs) == 0 || !utf8.Valid(bs) {
+		return false
+	}
+	for _, b := range bs {
+		if b <= ' ' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
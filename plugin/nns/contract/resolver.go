@@ -0,0 +1,133 @@
+package contract
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neofs-contract/nns"
+)
+
+// ResolverPrefix is the prefix of the TXT record delegating the domain and its subdomains
+// to another contract in the same chain. It's followed by the LE hex-encoded contract hash.
+const ResolverPrefix = "nns-resolver="
+
+// MaxDelegations is the maximum number of followed delegations.
+const MaxDelegations = 4
+
+// delegates are the contracts the names are delegated to, they are looked up once per request.
+type delegates struct {
+	mtx sync.Mutex
+	m   map[string]delegation
+}
+
+type delegation struct {
+	contract *Contract
+	err      error
+}
+
+func newDelegates() *delegates {
+	return &delegates{m: make(map[string]delegation)}
+}
+
+// Delegate returns the contract the name is delegated to. Resolver records are looked up from the
+// top-level domain down to the name, the ones below the delegation point are looked up in the contract
+// it's delegated to. The contract itself is returned if there are no resolver records. Resolvers must
+// implement 'getRecords' and 'getAllRecords' methods, the ones with only 'resolve' are rejected.
+// Delegates of the contracts returned by WithContext are looked up once.
+func (c *Contract) Delegate(name string) (*Contract, error) {
+	if c.delegates == nil {
+		return c.delegate(name)
+	}
+
+	c.delegates.mtx.Lock()
+	defer c.delegates.mtx.Unlock()
+	d, ok := c.delegates.m[name]
+	if !ok {
+		d.contract, d.err = c.delegate(name)
+		c.delegates.m[name] = d
+	}
+	return d.contract, d.err
+}
+
+func (c *Contract) delegate(name string) (*Contract, error) {
+	labels := strings.Split(name, dot)
+	visited := map[util.Uint160]struct{}{c.Hash(): {}}
+
+	cur := c
+	// Top-level domain is the root of the contract, so it's never delegated.
+	for i := len(labels) - 2; i >= 0; i-- {
+		domain := strings.Join(labels[i:], dot)
+		hash, ok, err := cur.resolver(domain)
+		if errors.Is(err, ErrFault) {
+			// The domain isn't registered, so its subdomains aren't registered too.
+			return cur, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		if _, ok := visited[hash]; ok {
+			return nil, fmt.Errorf("delegation loop at '%s': %s", domain, hash.StringLE())
+		}
+		if len(visited) > MaxDelegations {
+			return nil, fmt.Errorf("too many delegations at '%s'", domain)
+		}
+		if err := c.checkResolver(hash); err != nil {
+			return nil, fmt.Errorf("invalid resolver of '%s': %w", domain, err)
+		}
+		visited[hash] = struct{}{}
+		cur = cur.view(&contractHash{hash: hash}, cur.historic)
+	}
+
+	return cur, nil
+}
+
+// checkResolver makes sure the contract implements the methods the names are resolved with.
+// Successful checks are remembered, so the contract methods are checked once.
+func (c *Contract) checkResolver(hash util.Uint160) error {
+	if _, ok := c.resolvers.Load(hash); ok {
+		return nil
+	}
+
+	for _, m := range []struct {
+		name   string
+		params int
+	}{{"getRecords", 2}, {"getAllRecords", 1}} {
+		ok, err := c.chain().HasMethod(hash, m.name, m.params)
+		if err != nil {
+			return fmt.Errorf("get contract '%s': %w", hash.StringLE(), err)
+		}
+		if !ok {
+			return fmt.Errorf("contract '%s' doesn't implement '%s'", hash.StringLE(), m.name)
+		}
+	}
+	c.resolvers.Store(hash, struct{}{})
+	return nil
+}
+
+// resolver returns the hash of the contract the domain is delegated to.
+func (c *Contract) resolver(domain string) (util.Uint160, bool, error) {
+	records, err := c.GetRecords(domain, nns.TXT)
+	if err != nil {
+		return util.Uint160{}, false, err
+	}
+
+	for _, record := range records {
+		if !strings.HasPrefix(record, ResolverPrefix) {
+			continue
+		}
+		hash, err := util.Uint160DecodeStringLE(strings.TrimPrefix(strings.TrimPrefix(record, ResolverPrefix), "0x"))
+		if err != nil {
+			return util.Uint160{}, false, fmt.Errorf("invalid resolver of '%s': %w", domain, err)
+		}
+		return hash, true, nil
+	}
+
+	return util.Uint160{}, false, nil
+}
@@ -0,0 +1,85 @@
+package contract
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neofs-contract/nns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegate(t *testing.T) {
+	hashes := make([]util.Uint160, MaxDelegations+3)
+	for i := range hashes {
+		hashes[i] = util.Uint160{byte(i + 1)}
+	}
+	resolver := func(name string, hash util.Uint160) Record {
+		return Record{Name: name, Type: nns.TXT, Data: ResolverPrefix + hash.StringLE()}
+	}
+
+	// Names of 'chain.neofs' are delegated through all the contracts.
+	records := make(map[util.Uint160][]Record)
+	name := "chain.neofs"
+	for i := 0; i < len(hashes)-1; i++ {
+		records[hashes[i]] = append(records[hashes[i]], resolver(name, hashes[i+1]))
+		name = "sub." + name
+		records[hashes[i+1]] = append(records[hashes[i+1]], Record{Name: name, Type: nns.A, Data: "10.0.0.1"})
+	}
+	records[hashes[0]] = append(records[hashes[0]],
+		resolver("a.neofs", hashes[1]),
+		resolver("loop.neofs", hashes[1]),
+		resolver("resolve.neofs", util.Uint160{0xff}),
+	)
+	records[hashes[1]] = append(records[hashes[1]],
+		Record{Name: "a.neofs", Type: nns.A, Data: "10.0.0.1"},
+		resolver("x.loop.neofs", hashes[0]),
+	)
+	// The contract implementing only 'resolve'.
+	records[util.Uint160{0xff}] = nil
+
+	chain := newMemChain(records)
+	c := NewWithChain(&Params{ContractHash: hashes[0]}, chain)
+
+	for _, tc := range []struct {
+		name     string
+		expected util.Uint160
+		err      string
+	}{
+		{name: "b.a.neofs", expected: hashes[1]},
+		{name: "a.neofs", expected: hashes[1]},
+		{name: "b.unregistered.neofs", expected: hashes[0]},
+		{name: "sub.sub.chain.neofs", expected: hashes[MaxDelegations-1]},
+		{name: "x.loop.neofs", err: "delegation loop"},
+		{name: "resolve.neofs", err: "doesn't implement 'getRecords'"},
+		{name: "sub.sub.sub.sub.sub.chain.neofs", err: "too many delegations"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := c.Delegate(tc.name)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, d.Hash())
+		})
+	}
+
+	t.Run("once per request", func(t *testing.T) {
+		v := c.WithContext(context.Background())
+		d, err := v.Delegate("b.a.neofs")
+		require.NoError(t, err)
+		require.Equal(t, hashes[1], d.Hash())
+
+		// The delegation is removed, but the request keeps using the same delegate.
+		chain.SetRecords(hashes[0], []Record{{Name: "a.neofs", Type: nns.A, Data: "10.0.0.1"}})
+		cached, err := v.Delegate("b.a.neofs")
+		require.NoError(t, err)
+		require.True(t, d == cached)
+
+		d, err = c.WithContext(context.Background()).Delegate("b.a.neofs")
+		require.NoError(t, err)
+		require.Equal(t, hashes[0], d.Hash())
+	})
+}
@@ -0,0 +1,134 @@
+package contract
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nspcc-dev/neo-go/pkg/io"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient/actor"
+	"github.com/nspcc-dev/neo-go/pkg/rpcclient/invoker"
+	"github.com/nspcc-dev/neo-go/pkg/smartcontract/callflag"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neo-go/pkg/vm/emit"
+	"github.com/nspcc-dev/neo-go/pkg/wallet"
+	"github.com/nspcc-dev/neofs-contract/nns"
+)
+
+// txPollInterval is the interval of checking whether a sent transaction is persisted.
+const txPollInterval = time.Second
+
+// Call is a contract method invocation.
+type Call struct {
+	Method string
+	Params []interface{}
+}
+
+// AddRecord returns 'addRecord' method invocation.
+func AddRecord(name string, nnsType nns.RecordType, data string) Call {
+	return Call{Method: "addRecord", Params: []interface{}{name, int64(nnsType), data}}
+}
+
+// SetRecord returns 'setRecord' method invocation replacing the record with the id.
+func SetRecord(name string, nnsType nns.RecordType, id int, data string) Call {
+	return Call{Method: "setRecord", Params: []interface{}{name, int64(nnsType), int64(id), data}}
+}
+
+// DeleteRecords returns 'deleteRecords' method invocation.
+func DeleteRecords(name string, nnsType nns.RecordType) Call {
+	return Call{Method: "deleteRecords", Params: []interface{}{name, int64(nnsType)}}
+}
+
+// Invoke sends a transaction signed by the account that makes all the calls in a single script and waits
+// until it's persisted or ctx is done. The script is test invoked first, ErrFault is returned if it fails
+// there or in the persisted transaction. The transaction is sent only once via the endpoint it was test
+// invoked with, so it's never applied twice. The hash of the sent transaction is returned.
+func (c *Contract) Invoke(ctx context.Context, acc *wallet.Account, calls []Call) (util.Uint256, error) {
+	if len(calls) == 0 {
+		return util.Uint256{}, nil
+	}
+
+	w := io.NewBufBinWriter()
+	for _, call := range calls {
+		emit.AppCall(w.BinWriter, c.Hash(), call.Method, callflag.All, call.Params...)
+	}
+	if w.Err != nil {
+		return util.Uint256{}, fmt.Errorf("couldn't create script: %w", w.Err)
+	}
+	script := w.Bytes()
+
+	var (
+		cli   *rpcclient.Client
+		act   *actor.Actor
+		fault error
+	)
+	err := c.try(func(client *rpcclient.Client, _ *invoker.Invoker) error {
+		a, err := actor.NewSimple(client, acc)
+		if err != nil {
+			return err
+		}
+		res, err := a.Run(script)
+		if err != nil {
+			return err
+		}
+		if res.State != haltState {
+			// The transaction would fail in any node, so there is no point in trying others.
+			fault = fmt.Errorf("%w: %s", ErrFault, res.FaultException)
+			return nil
+		}
+		cli, act = client, a
+		return nil
+	})
+	if err != nil {
+		return util.Uint256{}, err
+	}
+	if fault != nil {
+		return util.Uint256{}, fault
+	}
+
+	var (
+		txHash util.Uint256
+		vub    uint32
+	)
+	// The transaction can be accepted by the node even if the call fails, so it's not retried.
+	err = c.await(func(context.Context) error {
+		var err error
+		txHash, vub, err = act.SendRun(script)
+		return err
+	})
+	if err != nil {
+		return util.Uint256{}, fmt.Errorf("send transaction: %w", err)
+	}
+
+	return txHash, waitTx(ctx, cli, txHash, vub)
+}
+
+// waitTx waits until the transaction is persisted or its valid until block passes.
+func waitTx(ctx context.Context, cli *rpcclient.Client, txHash util.Uint256, vub uint32) error {
+	tick := time.NewTicker(txPollInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction %s: %w", txHash.StringLE(), ctx.Err())
+		case <-tick.C:
+			// Block count is got before the log, so that the transaction can't be persisted in between.
+			count, countErr := cli.GetBlockCount()
+
+			appLog, err := cli.GetApplicationLog(txHash, nil)
+			if err == nil && len(appLog.Executions) != 0 {
+				exec := appLog.Executions[0]
+				if exec.VMState.String() != haltState {
+					return fmt.Errorf("%w: transaction %s: %s", ErrFault, txHash.StringLE(), exec.FaultException)
+				}
+				return nil
+			}
+
+			if countErr == nil && count > vub+1 {
+				return fmt.Errorf("transaction %s expired at block %d", txHash.StringLE(), vub)
+			}
+		}
+	}
+}
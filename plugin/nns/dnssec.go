@@ -0,0 +1,395 @@
+package nns
+
+import (
+	"encoding/base32"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/dnssec"
+	"github.com/miekg/dns"
+)
+
+// denialMode is the type of denial of existence records supplied for negative responses.
+type denialMode int
+
+const (
+	denialNone denialMode = iota
+	denialNSEC
+	denialNSEC3
+)
+
+// base32HexNoPad is the encoding of the hashed owner names in NSEC3 records.
+var base32HexNoPad = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+func parseDenialMode(s string) (denialMode, error) {
+	switch s {
+	case "nsec":
+		return denialNSEC, nil
+	case "nsec3":
+		return denialNSEC3, nil
+	default:
+		return denialNone, fmt.Errorf("unknown denial of existence type: %s", s)
+	}
+}
+
+// zoneCut returns the delegation point (a name below the apex with NS records) the name
+// is at or below and its NS records. Empty string is returned if there is no such point.
+func (n NNS) zoneCut(name string, qclass uint16, ttl uint32) (string, []dns.RR, error) {
+	zone := n.zone()
+	if !dns.IsSubDomain(zone, name) {
+		return "", nil, nil
+	}
+
+	// Look for the topmost cut, names below it are not authoritative data of the zone.
+	idx := dns.Split(name)
+	for i := len(idx) - dns.CountLabel(zone) - 1; i >= 0; i-- {
+		cut := name[idx[i]:]
+		ns, err := n.resolveAnswer(cut, dns.TypeNS, qclass, ttl)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(ns) != 0 {
+			return cut, ns, nil
+		}
+	}
+
+	return "", nil, nil
+}
+
+// referral forms the response for the name at or below the delegation point: NS records of the cut
+// with its DS records (or denial of their existence) in the authority section and glue records
+// in the additional section.
+func (n NNS) referral(name, cut string, ns []dns.RR, qclass uint16, ttl uint32) (*response, error) {
+	res := &response{
+		Ns:         ns,
+		Rcode:      dns.RcodeSuccess,
+		names:      []string{name, cut},
+		delegation: true,
+	}
+
+	ds, err := n.resolveAnswer(cut, dns.TypeDS, qclass, ttl)
+	if err != nil {
+		return nil, err
+	}
+	res.Ns = append(res.Ns, ds...)
+	if len(ds) == 0 {
+		types, err := n.types(cut)
+		if err != nil {
+			return nil, err
+		}
+		res.denial = n.denialRecord(cut, types, ttl)
+	}
+
+	for _, rr := range ns {
+		target := rr.(*dns.NS).Ns
+		if !dns.IsSubDomain(cut, target) {
+			continue
+		}
+		res.names = append(res.names, target)
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			glue, err := n.resolveAnswer(target, qtype, qclass, ttl)
+			if err != nil {
+				return nil, err
+			}
+			res.Extra = append(res.Extra, glue...)
+		}
+	}
+
+	return res, nil
+}
+
+// types returns types of the records of the name stored in any of the contracts.
+func (n NNS) types(name string) ([]uint16, error) {
+	var lastErr error
+	var resolved bool
+	var res []uint16
+
+	for _, nnsContract := range n.Contracts {
+		nnsName := nnsContract.PrepareName(name, n.dnsDomain)
+		delegate, err := n.delegate(nnsContract, nnsName)
+		if err != nil {
+			n.Log.Warningf("get types of '%s' in contract '%s': %s", name, nnsContract.Hash().StringLE(), err.Error())
+			lastErr = err
+			continue
+		}
+		types, err := delegate.Types(nnsName)
+		if err != nil {
+			n.Log.Warningf("get types of '%s' in contract '%s': %s", name, nnsContract.Hash().StringLE(), err.Error())
+			lastErr = err
+			continue
+		}
+		resolved = true
+		for _, t := range types {
+			res = append(res, uint16(t))
+		}
+	}
+
+	if !resolved {
+		return nil, lastErr
+	}
+
+	// CAA records are kept in TXT ones, so the name has them only if some TXT record keeps valid data.
+	for _, t := range res {
+		if t != dns.TypeTXT {
+			continue
+		}
+		caa, err := n.resolveAnswer(name, dns.TypeCAA, dns.ClassINET, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(caa) != 0 {
+			res = append(res, dns.TypeCAA)
+		}
+		break
+	}
+
+	return res, nil
+}
+
+// denialRecord returns NSEC or NSEC3 record proving that the name has only records of the types.
+// Non-existent names are proved to have no records (black lies), so NXDOMAIN becomes NODATA.
+func (n NNS) denialRecord(name string, types []uint16, ttl uint32) dns.RR {
+	if strings.EqualFold(name, n.zone()) {
+		types = append(types, dns.TypeDNSKEY)
+	}
+
+	switch n.denial {
+	case denialNSEC:
+		return &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+			NextDomain: "\\000." + name,
+			TypeBitMap: sortTypes(append(types, dns.TypeRRSIG, dns.TypeNSEC)),
+		}
+	case denialNSEC3:
+		if len(types) != 0 {
+			types = append(types, dns.TypeRRSIG)
+		}
+		hash := dns.HashName(strings.ToLower(name), dns.SHA1, 0, "")
+		return newNSEC3(hash, nextHash(hash), n.zone(), sortTypes(types), ttl)
+	}
+
+	return nil
+}
+
+// signZone adds DNSKEY records, NSEC or NSEC3 chain and signatures to the zone transfer records.
+// Records below delegation points and NS records at them are not signed.
+func (n NNS) signZone(axfr []dns.RR, now time.Time) ([]dns.RR, error) {
+	soa, ok := axfr[0].(*dns.SOA)
+	if !ok {
+		return nil, fmt.Errorf("soa record is missing")
+	}
+	apex := strings.ToLower(soa.Hdr.Name)
+
+	records := make([]dns.RR, 0, len(axfr)+len(n.keys))
+	records = append(records, axfr[:len(axfr)-1]...)
+	for _, key := range n.keys {
+		rr := dns.Copy(key.K)
+		rr.Header().Name = soa.Hdr.Name
+		rr.Header().Ttl = soa.Hdr.Ttl
+		records = append(records, rr)
+	}
+	if n.denial == denialNSEC3 {
+		records = append(records, &dns.NSEC3PARAM{
+			Hdr:  dns.RR_Header{Name: soa.Hdr.Name, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: soa.Minttl},
+			Hash: dns.SHA1,
+		})
+	}
+
+	sets := make(map[string]map[uint16][]dns.RR)
+	for _, rr := range records {
+		name := strings.ToLower(rr.Header().Name)
+		if sets[name] == nil {
+			sets[name] = make(map[uint16][]dns.RR)
+		}
+		sets[name][rr.Header().Rrtype] = append(sets[name][rr.Header().Rrtype], rr)
+	}
+
+	var cuts []string
+	for name, set := range sets {
+		if _, ok := set[dns.TypeNS]; ok && name != apex {
+			cuts = append(cuts, name)
+		}
+	}
+	authoritative := func(name string) bool {
+		for _, cut := range cuts {
+			if name != cut && dns.IsSubDomain(cut, name) {
+				return false
+			}
+		}
+		return dns.IsSubDomain(apex, name)
+	}
+	isCut := func(name string) bool {
+		return name != apex && len(sets[name][dns.TypeNS]) != 0
+	}
+
+	var names []string
+	for name := range sets {
+		if authoritative(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+
+	typesOf := func(name string) []uint16 {
+		var types []uint16
+		for t := range sets[name] {
+			types = append(types, t)
+		}
+		return types
+	}
+
+	var result []dns.RR
+	switch n.denial {
+	case denialNSEC3:
+		hashed := make(map[string]string)
+		for _, name := range names {
+			hashed[dns.HashName(name, dns.SHA1, 0, "")] = name
+			// Empty non-terminals have NSEC3 records too.
+			for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+				parent := name[off:]
+				if !dns.IsSubDomain(apex, parent) || parent == apex {
+					break
+				}
+				if _, ok := sets[parent]; !ok {
+					hashed[dns.HashName(parent, dns.SHA1, 0, "")] = parent
+				}
+			}
+		}
+		hashes := make([]string, 0, len(hashed))
+		for hash := range hashed {
+			hashes = append(hashes, hash)
+		}
+		sort.Strings(hashes)
+		for i, hash := range hashes {
+			types := typesOf(hashed[hash])
+			if len(types) != 0 && !(isCut(hashed[hash]) && len(sets[hashed[hash]][dns.TypeDS]) == 0) {
+				types = append(types, dns.TypeRRSIG)
+			}
+			result = append(result, newNSEC3(hash, hashes[(i+1)%len(hashes)], apex, sortTypes(types), soa.Minttl))
+		}
+	default:
+		for i, name := range names {
+			types := append(typesOf(name), dns.TypeRRSIG, dns.TypeNSEC)
+			result = append(result, &dns.NSEC{
+				Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: soa.Minttl},
+				NextDomain: names[(i+1)%len(names)],
+				TypeBitMap: sortTypes(types),
+			})
+		}
+	}
+	for _, rr := range result {
+		name := strings.ToLower(rr.Header().Name)
+		if sets[name] == nil {
+			sets[name] = make(map[uint16][]dns.RR)
+		}
+		sets[name][rr.Header().Rrtype] = []dns.RR{rr}
+	}
+	result = append(result, records...)
+
+	var sigs []dns.RR
+	for name, set := range sets {
+		if !authoritative(name) {
+			continue
+		}
+		for t, rrs := range set {
+			if t == dns.TypeRRSIG || (t == dns.TypeNS && isCut(name)) {
+				continue
+			}
+			for _, key := range n.keys {
+				sig, err := key.Sign(rrs, soa.Hdr.Name, rrs[0].Header().Ttl, now)
+				if err != nil {
+					return nil, fmt.Errorf("couldn't sign '%s' (type %s): %w", name, dns.Type(t), err)
+				}
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	result = append(result, sigs...)
+
+	rest := result[:0]
+	for _, rr := range result {
+		if rr != dns.RR(soa) {
+			rest = append(rest, rr)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		a, b := rest[i].Header(), rest[j].Header()
+		if !strings.EqualFold(a.Name, b.Name) {
+			return canonicalLess(a.Name, b.Name)
+		}
+		return a.Rrtype < b.Rrtype
+	})
+
+	return append(append([]dns.RR{soa}, rest...), soa), nil
+}
+
+// parseKeys reads DNSSEC key pairs, the same way as the dnssec plugin does.
+func parseKeys(root string, files []string) ([]*dnssec.DNSKEY, error) {
+	keys := make([]*dnssec.DNSKEY, 0, len(files))
+	for _, file := range files {
+		base := strings.TrimSuffix(strings.TrimSuffix(file, ".key"), ".private")
+		if !filepath.IsAbs(base) && root != "" {
+			base = filepath.Join(root, base)
+		}
+		key, err := dnssec.ParseKeyFile(base+".key", base+".private")
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func newNSEC3(hash, next, zone string, types []uint16, ttl uint32) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(hash) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl},
+		Hash:       dns.SHA1,
+		HashLength: 20,
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// nextHash returns the hash following the base32hex encoded one, so the NSEC3 record
+// covers only the hash itself.
+func nextHash(hash string) string {
+	b, err := base32HexNoPad.DecodeString(strings.ToUpper(hash))
+	if err != nil {
+		return hash
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			break
+		}
+	}
+	return base32HexNoPad.EncodeToString(b)
+}
+
+// sortTypes sorts types and removes duplicates.
+func sortTypes(types []uint16) []uint16 {
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	res := types[:0]
+	for i, t := range types {
+		if i == 0 || t != types[i-1] {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// canonicalLess compares names in canonical DNS order (RFC 4034, section 6.1).
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		x, y := la[len(la)-i], lb[len(lb)-i]
+		if x != y {
+			return x < y
+		}
+	}
+	return len(la) < len(lb)
+}
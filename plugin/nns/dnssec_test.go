@@ -0,0 +1,143 @@
+package nns
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPubKey  = `neofs. IN DNSKEY 257 3 13 0J8u0XJ9GNGFEBXuAmLu04taHG4BXPP3gwhetiOUMnGA+x09nqzgF5IY OyjWB7N3rXqQbnOSILhH1hnuyh7mmA==`
+	testPrivKey = `Private-key-format: v1.3
+Algorithm: 13 (ECDSAP256SHA256)
+PrivateKey: /4BZk8AFvyW5hL3cOLSVxIp1RTqHSAEloWUxj86p3gs=
+Created: 20160423195532
+Publish: 20160423195532
+Activate: 20160423195532
+`
+)
+
+func TestDenialRecord(t *testing.T) {
+	n := NNS{dnsDomain: "neofs", denial: denialNSEC}
+
+	nsec := n.denialRecord("a.neofs.", []uint16{dns.TypeA}, 60).(*dns.NSEC)
+	require.Equal(t, "a.neofs.", nsec.Hdr.Name)
+	require.Equal(t, "\\000.a.neofs.", nsec.NextDomain)
+	require.Equal(t, []uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC}, nsec.TypeBitMap)
+
+	nsec = n.denialRecord("neofs.", []uint16{dns.TypeSOA}, 60).(*dns.NSEC)
+	require.Equal(t, []uint16{dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY}, nsec.TypeBitMap)
+
+	n.denial = denialNSEC3
+	nsec3 := n.denialRecord("a.neofs.", nil, 60).(*dns.NSEC3)
+	require.True(t, nsec3.Match("a.neofs."))
+	require.False(t, nsec3.Cover("b.neofs."))
+	require.Empty(t, nsec3.TypeBitMap)
+}
+
+func TestNextHash(t *testing.T) {
+	require.Equal(t, "00000000000000000000000000000001", nextHash("00000000000000000000000000000000"))
+	require.Equal(t, "00000000000000000000000000000010", nextHash("0000000000000000000000000000000V"))
+}
+
+func TestCanonicalLess(t *testing.T) {
+	names := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "*.z.example."}
+	for i := 1; i < len(names); i++ {
+		require.True(t, canonicalLess(names[i-1], names[i]), names[i])
+		require.False(t, canonicalLess(names[i], names[i-1]), names[i])
+	}
+}
+
+func TestSignZone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nns")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Kneofs.key"), []byte(testPubKey), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Kneofs.private"), []byte(testPrivKey), 0600))
+
+	keys, err := parseKeys(dir, []string{"Kneofs.key"})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	axfr := []dns.RR{
+		test.SOA("neofs. 3600 IN SOA ns.neofs. admin.neofs. 10 3600 600 86400 60"),
+		test.A("a.neofs. 60 IN A 10.0.0.1"),
+		test.NS("sub.neofs. 60 IN NS ns.sub.neofs."),
+		test.A("ns.sub.neofs. 60 IN A 10.0.0.2"),
+		test.A("x.y.neofs. 60 IN A 10.0.0.3"),
+		test.SOA("neofs. 3600 IN SOA ns.neofs. admin.neofs. 10 3600 600 86400 60"),
+	}
+
+	for _, mode := range []denialMode{denialNSEC, denialNSEC3} {
+		n := NNS{dnsDomain: "neofs", denial: mode, keys: keys}
+
+		signed, err := n.signZone(axfr, time.Now().UTC())
+		require.NoError(t, err)
+		require.Equal(t, dns.TypeSOA, signed[0].Header().Rrtype)
+		require.Equal(t, dns.TypeSOA, signed[len(signed)-1].Header().Rrtype)
+
+		sets := make(map[string]map[uint16][]dns.RR)
+		sigs := make(map[string]map[uint16]*dns.RRSIG)
+		for _, rr := range signed[:len(signed)-1] {
+			name := rr.Header().Name
+			if sig, ok := rr.(*dns.RRSIG); ok {
+				if sigs[name] == nil {
+					sigs[name] = make(map[uint16]*dns.RRSIG)
+				}
+				sigs[name][sig.TypeCovered] = sig
+				continue
+			}
+			if sets[name] == nil {
+				sets[name] = make(map[uint16][]dns.RR)
+			}
+			sets[name][rr.Header().Rrtype] = append(sets[name][rr.Header().Rrtype], rr)
+		}
+
+		dnskey := sets["neofs."][dns.TypeDNSKEY][0].(*dns.DNSKEY)
+		for name, set := range sets {
+			for typ, rrs := range set {
+				sig := sigs[name][typ]
+				if name == "ns.sub.neofs." || (name == "sub.neofs." && typ == dns.TypeNS) {
+					require.Nil(t, sig, "%s %s", name, dns.Type(typ))
+					continue
+				}
+				require.NotNil(t, sig, "%s %s", name, dns.Type(typ))
+				require.NoError(t, sig.Verify(dnskey, rrs), "%s %s", name, dns.Type(typ))
+			}
+		}
+
+		switch mode {
+		case denialNSEC:
+			require.Len(t, sets["a.neofs."][dns.TypeNSEC], 1)
+			require.Equal(t, "sub.neofs.", sets["a.neofs."][dns.TypeNSEC][0].(*dns.NSEC).NextDomain)
+			require.Equal(t, "neofs.", sets["x.y.neofs."][dns.TypeNSEC][0].(*dns.NSEC).NextDomain)
+			require.Empty(t, sets["ns.sub.neofs."][dns.TypeNSEC])
+		case denialNSEC3:
+			require.Len(t, sets["neofs."][dns.TypeNSEC3PARAM], 1)
+			var nsec3s []*dns.NSEC3
+			for _, set := range sets {
+				for _, rr := range set[dns.TypeNSEC3] {
+					nsec3s = append(nsec3s, rr.(*dns.NSEC3))
+				}
+			}
+			// apex, a, sub, x.y and empty non-terminal y
+			require.Len(t, nsec3s, 5)
+			matched := func(name string) bool {
+				for _, rr := range nsec3s {
+					if rr.Match(name) {
+						return true
+					}
+				}
+				return false
+			}
+			require.True(t, matched("y.neofs."))
+			require.False(t, matched("ns.sub.neofs."))
+		}
+	}
+}
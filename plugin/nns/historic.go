@@ -0,0 +1,78 @@
+package nns
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/miekg/dns"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+)
+
+// defaultHistoricCode is the default EDNS0 local option code of the historic state request.
+const defaultHistoricCode = 65001
+
+// historicPoint is the past chain state the request is resolved at:
+// the block height or the state root (or block hash).
+type historicPoint struct {
+	height uint32
+	root   util.Uint256
+	byRoot bool
+}
+
+// historicOption returns the chain state requested with the EDNS0 local option with the code.
+// Option data is either 4 bytes of big-endian block height or 32 bytes of state root (or block hash)
+// in the order it's printed by the node. Nil is returned if there is no such option.
+func historicOption(r *dns.Msg, code uint16) (*historicPoint, error) {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil, nil
+	}
+
+	for _, o := range opt.Option {
+		local, ok := o.(*dns.EDNS0_LOCAL)
+		if !ok || local.Code != code {
+			continue
+		}
+		switch len(local.Data) {
+		case 4:
+			return &historicPoint{height: binary.BigEndian.Uint32(local.Data)}, nil
+		case util.Uint256Size:
+			root, err := util.Uint256DecodeBytesLE(local.Data)
+			if err != nil {
+				return nil, err
+			}
+			return &historicPoint{root: root, byRoot: true}, nil
+		default:
+			return nil, fmt.Errorf("invalid historic state option length: %d", len(local.Data))
+		}
+	}
+
+	return nil, nil
+}
+
+// String implements the fmt.Stringer interface.
+func (p historicPoint) String() string {
+	if p.byRoot {
+		return "state " + p.root.StringLE()
+	}
+	return fmt.Sprintf("height %d", p.height)
+}
+
+// atState returns the plugin resolving records at the past chain state.
+// Historic responses aren't cached and the SOA serial is taken from the contract.
+func (n NNS) atState(p *historicPoint) NNS {
+	contracts := make([]*contract.Contract, len(n.Contracts))
+	for i, nnsContract := range n.Contracts {
+		if p.byRoot {
+			contracts[i] = nnsContract.AtState(p.root)
+		} else {
+			contracts[i] = nnsContract.AtHeight(p.height)
+		}
+	}
+
+	n.Contracts = contracts
+	n.cache = nil
+	n.journal = nil
+	return n
+}
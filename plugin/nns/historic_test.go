@@ -0,0 +1,39 @@
+package nns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoricOption(t *testing.T) {
+	newMsg := func(opts ...dns.EDNS0) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("a.neofs.", dns.TypeA)
+		m.SetEdns0(4096, false)
+		m.IsEdns0().Option = opts
+		return m
+	}
+
+	point, err := historicOption(new(dns.Msg), defaultHistoricCode)
+	require.NoError(t, err)
+	require.Nil(t, point)
+
+	point, err = historicOption(newMsg(&dns.EDNS0_LOCAL{Code: defaultHistoricCode + 1, Data: []byte{0, 0, 0, 1}}), defaultHistoricCode)
+	require.NoError(t, err)
+	require.Nil(t, point)
+
+	point, err = historicOption(newMsg(&dns.EDNS0_LOCAL{Code: defaultHistoricCode, Data: []byte{0, 1, 0, 2}}), defaultHistoricCode)
+	require.NoError(t, err)
+	require.Equal(t, &historicPoint{height: 65538}, point)
+
+	root := make([]byte, 32)
+	root[0] = 0xab
+	point, err = historicOption(newMsg(&dns.EDNS0_LOCAL{Code: defaultHistoricCode, Data: root}), defaultHistoricCode)
+	require.NoError(t, err)
+	require.True(t, point.byRoot)
+
+	_, err = historicOption(newMsg(&dns.EDNS0_LOCAL{Code: defaultHistoricCode, Data: []byte{1, 2}}), defaultHistoricCode)
+	require.Error(t, err)
+}
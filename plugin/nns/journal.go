@@ -0,0 +1,199 @@
+package nns
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+const defaultJournalSize = 100
+
+// zoneJournal keeps the last transferred zone state and the changes between
+// its versions to answer IXFR requests. The zone is refreshed on new blocks,
+// the SOA serial is derived from the chain state every time the zone content changes.
+type zoneJournal struct {
+	mtx sync.RWMutex
+	// soa is the zone SOA with the served serial, nil until the first refresh.
+	soa *dns.SOA
+	// chainSerial is the serial stored in the contract.
+	chainSerial uint32
+	// records are the current zone records except SOA, keyed by their string form.
+	records map[string]dns.RR
+	// deltas are ordered from the oldest to the newest.
+	deltas []*zoneDelta
+	size   int
+}
+
+// zoneDelta is the difference between two zone versions.
+type zoneDelta struct {
+	from    *dns.SOA
+	to      *dns.SOA
+	removed []dns.RR
+	added   []dns.RR
+}
+
+func newZoneJournal(size int) *zoneJournal {
+	return &zoneJournal{size: size}
+}
+
+// SOA returns the zone SOA with the served serial or nil if the journal
+// hasn't been filled yet.
+func (j *zoneJournal) SOA() *dns.SOA {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+	if j.soa == nil {
+		return nil
+	}
+	return dns.Copy(j.soa).(*dns.SOA)
+}
+
+// Serial returns the served zone serial and false if the journal hasn't been
+// filled yet.
+func (j *zoneJournal) Serial() (uint32, bool) {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+	if j.soa == nil {
+		return 0, false
+	}
+	return j.soa.Serial, true
+}
+
+// Update stores the new zone state from the AXFR records (bracketed by SOA) transferred at the
+// chain heights and returns true if the zone has changed. The served serial is the sum of the serial
+// stored in the contract and the heights, so it's the same after restarts and in other servers
+// that see the change at the same block. If it isn't newer than the served one (e.g. the height of
+// some chain decreased after switching to a lagging node), the change is deferred until it is.
+func (j *zoneJournal) Update(axfr []dns.RR, heights []uint32) bool {
+	if len(axfr) < 2 {
+		return false
+	}
+	soa, ok := axfr[0].(*dns.SOA)
+	if !ok {
+		return false
+	}
+
+	records := make(map[string]dns.RR, len(axfr)-2)
+	for _, rr := range axfr[1 : len(axfr)-1] {
+		records[rr.String()] = rr
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	newSOA := dns.Copy(soa).(*dns.SOA)
+	newSOA.Serial = zoneSerial(soa.Serial, heights)
+
+	if j.soa == nil {
+		j.soa = newSOA
+		j.chainSerial = soa.Serial
+		j.records = records
+		return true
+	}
+
+	delta := &zoneDelta{from: j.soa}
+	for key, rr := range j.records {
+		if _, ok := records[key]; !ok {
+			delta.removed = append(delta.removed, rr)
+		}
+	}
+	for key, rr := range records {
+		if _, ok := j.records[key]; !ok {
+			delta.added = append(delta.added, rr)
+		}
+	}
+
+	if len(delta.removed) == 0 && len(delta.added) == 0 && soa.Serial == j.chainSerial && equalSOA(soa, j.soa) {
+		return false
+	}
+
+	if !serialNewer(newSOA.Serial, j.soa.Serial) {
+		return false
+	}
+	delta.to = newSOA
+
+	j.deltas = append(j.deltas, delta)
+	if len(j.deltas) > j.size {
+		j.deltas = j.deltas[len(j.deltas)-j.size:]
+	}
+	j.soa = newSOA
+	j.chainSerial = soa.Serial
+	j.records = records
+
+	return true
+}
+
+// AXFR returns the current zone records bracketed by SOA.
+func (j *zoneJournal) AXFR() []dns.RR {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+
+	res := make([]dns.RR, 0, len(j.records)+2)
+	res = append(res, j.soa)
+	for _, rr := range j.records {
+		res = append(res, rr)
+	}
+	sortRRs(res[1:])
+	return append(res, j.soa)
+}
+
+// IXFR returns the changes since the serial in RFC 1995 format and false
+// if the journal doesn't have them (AXFR must be used then).
+func (j *zoneJournal) IXFR(serial uint32) ([]dns.RR, bool) {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+
+	start := -1
+	for i, delta := range j.deltas {
+		if delta.from.Serial == serial {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, false
+	}
+
+	res := []dns.RR{j.soa}
+	for _, delta := range j.deltas[start:] {
+		res = append(res, delta.from)
+		res = append(res, delta.removed...)
+		res = append(res, delta.to)
+		res = append(res, delta.added...)
+	}
+	return append(res, j.soa), true
+}
+
+// zoneSerial returns the served serial of the zone with the serial stored in the contract
+// at the chain heights. Both of them only grow, so does the sum (in serial number arithmetic).
+func zoneSerial(chainSerial uint32, heights []uint32) uint32 {
+	serial := chainSerial
+	for _, height := range heights {
+		serial += height
+	}
+	return serial
+}
+
+// sortRRs sorts records by name and type.
+func sortRRs(rrs []dns.RR) {
+	sort.Slice(rrs, func(i, j int) bool {
+		if rrs[i].Header().Name != rrs[j].Header().Name {
+			return rrs[i].Header().Name < rrs[j].Header().Name
+		}
+		if rrs[i].Header().Rrtype != rrs[j].Header().Rrtype {
+			return rrs[i].Header().Rrtype < rrs[j].Header().Rrtype
+		}
+		return rrs[i].String() < rrs[j].String()
+	})
+}
+
+// serialNewer checks whether serial a is newer than b according to RFC 1982.
+func serialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// equalSOA checks whether SOA records are equal ignoring serial.
+func equalSOA(a, b *dns.SOA) bool {
+	return a.Ns == b.Ns && a.Mbox == b.Mbox && a.Refresh == b.Refresh && a.Retry == b.Retry &&
+		a.Expire == b.Expire && a.Minttl == b.Minttl && a.Hdr.Ttl == b.Hdr.Ttl
+}
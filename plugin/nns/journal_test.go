@@ -0,0 +1,95 @@
+package nns
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneJournal(t *testing.T) {
+	soa := func(serial string) dns.RR {
+		return test.SOA("neofs. 3600 IN SOA ns.neofs. admin.neofs. " + serial + " 3600 600 86400 60")
+	}
+	zone := func(serial string, rrs ...dns.RR) []dns.RR {
+		return append(append([]dns.RR{soa(serial)}, rrs...), soa(serial))
+	}
+	a1 := test.A("a.neofs. 60 IN A 10.0.0.1")
+	a2 := test.A("a.neofs. 60 IN A 10.0.0.2")
+	txt := test.TXT("b.neofs. 60 IN TXT \"hello\"")
+
+	j := newZoneJournal(2)
+	_, ok := j.Serial()
+	require.False(t, ok)
+
+	require.True(t, j.Update(zone("10", a1), []uint32{100}))
+	require.False(t, j.Update(zone("10", a1), []uint32{101}))
+	serial, ok := j.Serial()
+	require.True(t, ok)
+	require.Equal(t, uint32(110), serial)
+
+	t.Run("serial bump", func(t *testing.T) {
+		require.True(t, j.Update(zone("10", a1, txt), []uint32{102}))
+		serial, _ := j.Serial()
+		require.Equal(t, uint32(112), serial)
+
+		require.True(t, j.Update(zone("20", a2, txt), []uint32{103}))
+		serial, _ = j.Serial()
+		require.Equal(t, uint32(123), serial)
+
+		// The change is deferred until the serial derived from the chain state is newer.
+		require.False(t, j.Update(zone("20", a2), []uint32{90}))
+		serial, _ = j.Serial()
+		require.Equal(t, uint32(123), serial)
+	})
+
+	t.Run("ixfr", func(t *testing.T) {
+		recs, ok := j.IXFR(110)
+		require.True(t, ok)
+		require.Len(t, recs, 9)
+		require.Equal(t, uint32(123), recs[0].(*dns.SOA).Serial)
+		require.Equal(t, uint32(110), recs[1].(*dns.SOA).Serial)
+		require.Equal(t, uint32(112), recs[2].(*dns.SOA).Serial)
+		require.Equal(t, txt, recs[3])
+		require.Equal(t, uint32(112), recs[4].(*dns.SOA).Serial)
+		require.Equal(t, a1, recs[5])
+		require.Equal(t, uint32(123), recs[6].(*dns.SOA).Serial)
+		require.Equal(t, a2, recs[7])
+		require.Equal(t, uint32(123), recs[8].(*dns.SOA).Serial)
+
+		_, ok = j.IXFR(105)
+		require.False(t, ok)
+	})
+
+	t.Run("journal size", func(t *testing.T) {
+		require.True(t, j.Update(zone("20", a2), []uint32{104}))
+		_, ok := j.IXFR(110)
+		require.False(t, ok)
+		_, ok = j.IXFR(112)
+		require.True(t, ok)
+	})
+
+	t.Run("axfr", func(t *testing.T) {
+		recs := j.AXFR()
+		require.Len(t, recs, 3)
+		require.Equal(t, uint32(124), recs[0].(*dns.SOA).Serial)
+		require.Equal(t, a2, recs[1])
+		require.Equal(t, uint32(124), recs[2].(*dns.SOA).Serial)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		// The serial is the same after restart.
+		restarted := newZoneJournal(2)
+		require.True(t, restarted.Update(zone("20", a2), []uint32{104}))
+		serial, _ := restarted.Serial()
+		require.Equal(t, uint32(124), serial)
+	})
+}
+
+func TestSerialNewer(t *testing.T) {
+	require.True(t, serialNewer(2, 1))
+	require.False(t, serialNewer(1, 1))
+	require.False(t, serialNewer(1, 2))
+	require.True(t, serialNewer(1, 0xffffffff))
+}
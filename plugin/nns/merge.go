@@ -0,0 +1,121 @@
+package nns
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/miekg/dns"
+	"github.com/nspcc-dev/neofs-contract/nns"
+)
+
+// mergePolicy defines how the results of multiple contracts are combined.
+type mergePolicy int
+
+const (
+	// mergeLast uses the result of the last contract (in the order of appearance) that has one.
+	mergeLast mergePolicy = iota
+	// mergeFirst uses the result of the first contract (in the order of appearance) that has one.
+	mergeFirst
+	// mergeUnion combines the results of all contracts.
+	mergeUnion
+	// mergePriority uses the result of the contract with the lowest priority value that has one.
+	mergePriority
+)
+
+func parseMergePolicy(s string) (mergePolicy, error) {
+	switch s {
+	case "last":
+		return mergeLast, nil
+	case "first":
+		return mergeFirst, nil
+	case "union":
+		return mergeUnion, nil
+	case "priority":
+		return mergePriority, nil
+	default:
+		return 0, fmt.Errorf("unknown merge policy: %s", s)
+	}
+}
+
+// orderedContracts returns the contracts in the order their results are taken with:
+// the first one that has a result is used (all of them for union policy).
+func (n NNS) orderedContracts() []*contract.Contract {
+	res := make([]*contract.Contract, len(n.Contracts))
+	copy(res, n.Contracts)
+
+	switch n.merge {
+	case mergeLast:
+		for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+			res[i], res[j] = res[j], res[i]
+		}
+	case mergePriority:
+		priorities := make(map[*contract.Contract]int, len(n.Contracts))
+		for i, nnsContract := range n.Contracts {
+			if i < len(n.priorities) {
+				priorities[nnsContract] = n.priorities[i]
+			}
+		}
+		sort.SliceStable(res, func(i, j int) bool {
+			return priorities[res[i]] < priorities[res[j]]
+		})
+	}
+
+	return res
+}
+
+// mergeRecords adds the records to the result according to the merge policy.
+// Records sets are merged for union policy, otherwise the present ones are kept.
+// The zone SOA is always the one of the first contract, SOA records of the others are skipped.
+func (n NNS) mergeRecords(result map[string]*Records, records map[string]*Records, first bool) {
+	for key, recs := range records {
+		if recs.Type == nns.RecordType(dns.TypeSOA) && !first {
+			continue
+		}
+		existing, ok := result[key]
+		if !ok {
+			result[key] = recs
+			continue
+		}
+		if n.merge != mergeUnion {
+			continue
+		}
+		for i, data := range recs.Data {
+			if containsString(existing.Data, data) {
+				continue
+			}
+			existing.Data = append(existing.Data, data)
+			var ttl uint32
+			if i < len(recs.TTLs) {
+				ttl = recs.TTLs[i]
+			}
+			existing.TTLs = append(existing.TTLs, ttl)
+		}
+	}
+}
+
+// unionRRs appends the records which are not in the result yet.
+func unionRRs(result []dns.RR, rrs []dns.RR) []dns.RR {
+	for _, rr := range rrs {
+		duplicate := false
+		for _, r := range result {
+			if dns.IsDuplicate(r, rr) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, rr)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
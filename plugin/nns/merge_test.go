@@ -0,0 +1,74 @@
+package nns
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/nspcc-dev/neofs-contract/nns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedContracts(t *testing.T) {
+	contracts := []*contract.Contract{{}, {}, {}}
+
+	n := NNS{Contracts: contracts, merge: mergeFirst}
+	require.Equal(t, contracts, n.orderedContracts())
+
+	n.merge = mergeUnion
+	require.Equal(t, contracts, n.orderedContracts())
+
+	n.merge = mergeLast
+	require.Equal(t, []*contract.Contract{contracts[2], contracts[1], contracts[0]}, n.orderedContracts())
+
+	n.merge = mergePriority
+	n.priorities = []int{10, 0, 10}
+	require.Equal(t, []*contract.Contract{contracts[1], contracts[0], contracts[2]}, n.orderedContracts())
+}
+
+func TestMergeRecords(t *testing.T) {
+	newRecords := func(data ...string) map[string]*Records {
+		return map[string]*Records{
+			recKey("a.neofs.", nns.A): {Name: "a.neofs.", Type: nns.A, Data: data, TTLs: make([]uint32, len(data))},
+		}
+	}
+
+	n := NNS{merge: mergeFirst}
+	result := make(map[string]*Records)
+	n.mergeRecords(result, newRecords("10.0.0.1"), true)
+	n.mergeRecords(result, newRecords("10.0.0.2"), false)
+	require.Equal(t, []string{"10.0.0.1"}, result[recKey("a.neofs.", nns.A)].Data)
+
+	n.merge = mergeUnion
+	result = make(map[string]*Records)
+	n.mergeRecords(result, newRecords("10.0.0.1"), true)
+	n.mergeRecords(result, newRecords("10.0.0.1", "10.0.0.2"), false)
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, result[recKey("a.neofs.", nns.A)].Data)
+	require.Len(t, result[recKey("a.neofs.", nns.A)].TTLs, 2)
+
+	// The SOA of the first contract is kept regardless of the policy and the order.
+	soaKey := recKey("neofs.", nns.RecordType(dns.TypeSOA))
+	newSOA := func(serial string) map[string]*Records {
+		return map[string]*Records{
+			soaKey: {Name: "neofs.", Type: nns.RecordType(dns.TypeSOA), Data: []string{"neofs ops@neofs " + serial + " 3600 600 604800 300"}, TTLs: []uint32{0}},
+		}
+	}
+	for _, policy := range []mergePolicy{mergeUnion, mergeLast} {
+		n.merge = policy
+		result = make(map[string]*Records)
+		n.mergeRecords(result, newSOA("2"), false)
+		n.mergeRecords(result, newSOA("1"), true)
+		n.mergeRecords(result, newSOA("3"), false)
+		require.Equal(t, []string{"neofs ops@neofs 1 3600 600 604800 300"}, result[soaKey].Data)
+	}
+}
+
+func TestUnionRRs(t *testing.T) {
+	a1 := test.A("a.neofs. 60 IN A 10.0.0.1")
+	a2 := test.A("a.neofs. 60 IN A 10.0.0.2")
+
+	res := unionRRs(nil, []dns.RR{a1})
+	res = unionRRs(res, []dns.RR{test.A("a.neofs. 30 IN A 10.0.0.1"), a2})
+	require.Equal(t, []dns.RR{a1, a2}, res)
+}
@@ -0,0 +1,37 @@
+package nns
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// cacheRequests is a counter of all requests through the nns cache.
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "cache_requests_total",
+		Help:      "The count of nns cache requests.",
+	}, []string{"server"})
+	// cacheHits is a counter of nns cache hits by result type.
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "cache_hits_total",
+		Help:      "The count of nns cache hits.",
+	}, []string{"server", "type"})
+	// cacheMisses is a counter of nns cache misses.
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "cache_misses_total",
+		Help:      "The count of nns cache misses.",
+	}, []string{"server"})
+)
+
+const (
+	hitSuccess = "success"
+	hitDenial  = "denial"
+)
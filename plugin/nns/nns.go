@@ -2,15 +2,23 @@ package nns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/dnssec"
+	"github.com/coredns/coredns/plugin/metrics"
 	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/fall"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/plugin/transfer"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
@@ -21,40 +29,179 @@ type NNS struct {
 	Next      plugin.Handler
 	Contracts []*contract.Contract
 	Log       clog.P
+	Fall      fall.F
+	Upstream  *upstream.Upstream
 	dnsDomain string
+	cache     *recordCache
+	journal   *zoneJournal
+	// merge is the policy of combining results of multiple contracts,
+	// priorities are used by the priority policy.
+	merge      mergePolicy
+	priorities []int
+	// denial is the type of denial of existence records, zone cuts are handled if it's set.
+	// keys are used to sign zone transfers.
+	denial denialMode
+	keys   []*dnssec.DNSKEY
+	// update is set if dynamic updates are enabled.
+	update *updater
+	// reverse is set if PTR records are synthesized from A/AAAA records of the zone.
+	reverse *reverseIndex
+	// delegation is set if resolver records delegating domains to other contracts are followed.
+	delegation bool
+	// snapshot is the local copy of the zone served when the contracts are unavailable.
+	snapshot *snapshot
+	// historicCode is the EDNS0 option code of historic state requests, zero if they are disabled.
+	historicCode uint16
+	// rewrites map DNS zones of requests to NNS domains.
+	rewrites rewriteTable
+	// ttl is used for all records if ttlOverride is set,
+	// otherwise the zone SOA minimum is used.
+	ttl         uint32
+	ttlOverride bool
+}
+
+// response is the resolved reply to the request.
+type response struct {
+	Answer []dns.RR
+	Ns     []dns.RR
+	Extra  []dns.RR
+	Rcode  int
+
+	// delegation is set for referrals to the names below zone cuts.
+	delegation bool
+	// denial is NSEC or NSEC3 record for negative responses and referrals without DS,
+	// it's added to replies to DNSSEC aware clients.
+	denial dns.RR
+
+	// names are the names looked up in the contracts to form the response.
+	names []string
+	// external is set if the response contains data resolved outside the contracts.
+	external bool
 }
 
 type Records struct {
 	Name string
 	Type nns.RecordType
 	Data []string
+	// TTLs are TTLs of records stored in the contract, zero if it doesn't store them.
+	TTLs []uint32
 }
 
-const dot = "."
+const (
+	dot = "."
+
+	// maxChain is the maximum number of followed in-zone CNAME records.
+	maxChain = 8
+
+	// transferChunkSize is the maximum number of records sent in one chunk of zone transfer.
+	transferChunkSize = 100
+)
 
 // ServeDNS implements the plugin.Handler interface.
 // This method gets called when example is used in a Server.
 func (n NNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
-	res, err := n.resolveRecords(request.Request{W: w, Req: r})
+	n = n.withContext(ctx)
+
+	state := request.Request{W: w, Req: r}
+	if zone, domain, ok := n.rewrites.match(state.Name()); ok {
+		n = n.withRewrite(zone, domain)
+	}
+
+	if r.Opcode == dns.OpcodeUpdate {
+		return n.serveUpdate(ctx, w, r)
+	}
+
+	var point *historicPoint
+	if n.historicCode != 0 {
+		var err error
+		if point, err = historicOption(r, n.historicCode); err != nil {
+			n.Log.Debug(err)
+			return dns.RcodeFormatError, nil
+		}
+		if point != nil {
+			n.Log.Debugf("resolving '%s' at %s", state.Name(), point)
+			n = n.atState(point)
+		}
+	}
+
+	if n.reverse != nil && point == nil && state.QType() == dns.TypePTR && isReverse(state.Name()) {
+		return n.serveReverse(ctx, state)
+	}
+
+	res, err := n.resolve(ctx, state)
+	if err != nil && n.snapshot != nil && point == nil {
+		if snapRes, ok := n.snapshot.Lookup(ctx, state); ok {
+			n.Log.Debugf("resolving '%s' from snapshot: %s", state.Name(), err)
+			res, err = snapRes, nil
+		}
+	}
 	if err != nil {
 		n.Log.Warning(err)
+		if n.Fall.Through(state.Name()) {
+			return plugin.NextOrFailure(n.Name(), n.Next, ctx, w, r)
+		}
+		return dns.RcodeServerFailure, nil
+	}
+
+	if res.Rcode == dns.RcodeNameError && n.Fall.Through(state.Name()) {
 		return plugin.NextOrFailure(n.Name(), n.Next, ctx, w, r)
 	}
 
 	m := new(dns.Msg)
 	m.SetReply(r)
-	m.Answer = res
+	m.Authoritative = !res.delegation
+	m.Rcode = res.Rcode
+	m.Answer = res.Answer
+	m.Ns = res.Ns
+	m.Extra = res.Extra
+	if res.denial != nil && state.Do() {
+		// Non-existent names are denied with black lies.
+		m.Ns = append(m.Ns, res.denial)
+		m.Rcode = dns.RcodeSuccess
+	}
 
 	w.WriteMsg(m)
 	return dns.RcodeSuccess, nil
 }
 
+// serveReverse answers PTR query from the reverse index. The request is passed to the next plugin
+// if the address isn't in the index.
+func (n NNS) serveReverse(ctx context.Context, state request.Request) (int, error) {
+	answers := n.reverse.Lookup(state.Name(), dnsutil.ExtractAddressFromReverse(state.Name()))
+	if len(answers) == 0 {
+		return plugin.NextOrFailure(n.Name(), n.Next, ctx, state.W, state.Req)
+	}
+	if n.ttlOverride {
+		for _, rr := range answers {
+			rr.Header().Ttl = n.ttl
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	m.Answer = answers
+
+	state.W.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
 // Name implements the Handler interface.
 func (n NNS) Name() string { return pluginName }
 
-// Transfer implements the transfer.Transfer interface.
-// Don't use serial because we support only AXFR.
+// Transfer implements the transfer.Transfer interface. IXFR is supported if the zone journal
+// is enabled, otherwise AXFR is performed.
 func (n NNS) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	if dnsZone, domain, ok := n.rewrites.match(zone); ok {
+		n = n.withRewrite(dnsZone, domain)
+	}
+
+	if n.journal != nil && zone == n.zone() {
+		if soa := n.journal.SOA(); soa != nil {
+			return n.transferJournal(soa, serial), nil
+		}
+	}
+
 	trimmedZone := n.Contracts[0].PrepareName(zone, n.dnsDomain)
 	records, err := n.Contracts[0].GetRecords(trimmedZone, nns.RecordType(dns.TypeSOA))
 	if err != nil {
@@ -69,75 +216,654 @@ func (n NNS) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
 	go func() {
 		defer close(ch)
 
+		// Records of multiple contracts are merged and signed zones are sorted,
+		// so only the zone of a single contract can be streamed.
+		if len(n.Contracts) == 1 && len(n.keys) == 0 {
+			if err := n.streamTransfer(ch, zone, records); err != nil {
+				n.Log.Warningf("couldn't transfer zone '%s': %s", zone, err.Error())
+			}
+			return
+		}
+
 		recs, err := n.zoneTransfers(zone)
+		if err == nil && len(n.keys) != 0 {
+			recs, err = n.signZone(recs, time.Now().UTC())
+		}
 		if err != nil {
 			n.Log.Warningf("couldn't transfer zone '%s': %s", zone, err.Error())
 			return
 		}
 
-		ch <- recs
+		sendChunks(ch, recs)
 	}()
 
 	return ch, nil
 }
 
+// streamTransfer sends the zone records of the first contract in chunks as the records are traversed,
+// so the whole zone isn't kept in memory. The zone SOA (soaData is its data got before the transfer)
+// is sent first and last. The transfer is aborted (the closing SOA isn't sent) if the zone has no single
+// SOA or the SOA changes during the traversal.
+func (n NNS) streamTransfer(ch chan<- []dns.RR, zone string, soaData []string) error {
+	nnsContract := n.Contracts[0]
+	name := nnsContract.PrepareName(zone, n.dnsDomain)
+
+	soa, err := n.formTransferSOA(nnsContract, name, soaData)
+	if err != nil {
+		return err
+	}
+	ch <- []dns.RR{soa}
+
+	var (
+		chunk    = make([]dns.RR, 0, transferChunkSize)
+		soaCount int
+		formErr  error
+	)
+	err = nnsContract.TraverseAllRecords(name, func(batch []contract.Record) bool {
+		for _, record := range batch {
+			if record.Type == nns.RecordType(dns.TypeSOA) {
+				if strings.EqualFold(record.Name, name) {
+					soaCount++
+				}
+				continue
+			}
+
+			hdr := dns.RR_Header{
+				Name:   appendRoot(record.Name),
+				Rrtype: uint16(record.Type),
+				Class:  dns.ClassINET,
+				Ttl:    n.transferTTL(soa, record.TTL),
+			}
+			rec, err := formRec(uint16(record.Type), record.Data, hdr)
+			if err != nil {
+				formErr = err
+				return false
+			}
+			recs := []dns.RR{rec}
+			if record.Type == nns.TXT {
+				if caa := n.formCAARec(record.Data, hdr); caa != nil {
+					recs = append(recs, caa)
+				}
+			}
+			n.dnsNames(nnsContract, recs, true)
+			for _, rec := range recs {
+				chunk = append(chunk, rec)
+				if len(chunk) == transferChunkSize {
+					ch <- chunk
+					chunk = make([]dns.RR, 0, transferChunkSize)
+				}
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = formErr
+	}
+	if err != nil {
+		return err
+	}
+	if soaCount != 1 {
+		return fmt.Errorf("invalid number of soa records: %d", soaCount)
+	}
+
+	last, err := n.transferSOA(nnsContract, name)
+	if err != nil {
+		return err
+	}
+	if last.Serial != soa.Serial || !equalSOA(last, soa) {
+		return fmt.Errorf("zone has changed during transfer, serial %d -> %d", soa.Serial, last.Serial)
+	}
+
+	ch <- append(chunk, soa)
+	return nil
+}
+
+// transferSOA returns the SOA record of the zone stored in the contract.
+func (n NNS) transferSOA(nnsContract *contract.Contract, name string) (*dns.SOA, error) {
+	records, err := nnsContract.GetRecords(name, nns.RecordType(dns.TypeSOA))
+	if err != nil {
+		return nil, err
+	}
+	return n.formTransferSOA(nnsContract, name, records)
+}
+
+// formTransferSOA forms the SOA record of the zone from the data stored in the contract.
+func (n NNS) formTransferSOA(nnsContract *contract.Contract, name string, records []string) (*dns.SOA, error) {
+	soa, err := formSoaRecord(&Records{Name: appendRoot(name), Type: nns.RecordType(dns.TypeSOA), Data: records})
+	if err != nil {
+		return nil, err
+	}
+	n.dnsNames(nnsContract, []dns.RR{soa}, true)
+	return soa, nil
+}
+
+// sendChunks sends the records in chunks of bounded size.
+func sendChunks(ch chan<- []dns.RR, recs []dns.RR) {
+	for len(recs) > transferChunkSize {
+		ch <- recs[:transferChunkSize]
+		recs = recs[transferChunkSize:]
+	}
+	if len(recs) != 0 {
+		ch <- recs
+	}
+}
+
+// transferJournal transfers the zone from the journal. If the serial is up-to-date, only SOA is sent.
+// If the journal has changes since the serial, they are sent in IXFR format, otherwise the whole zone is.
+// Zone is signed if the keys are set.
+func (n NNS) transferJournal(soa *dns.SOA, serial uint32) <-chan []dns.RR {
+	ch := make(chan []dns.RR)
+	go func() {
+		defer close(ch)
+
+		if serial != 0 && !serialNewer(soa.Serial, serial) {
+			ch <- []dns.RR{soa}
+			return
+		}
+		// Changes are not signed, so signed zones are always transferred as a whole.
+		if serial != 0 && len(n.keys) == 0 {
+			if recs, ok := n.journal.IXFR(serial); ok {
+				sendChunks(ch, recs)
+				return
+			}
+		}
+
+		recs := n.journal.AXFR()
+		if len(n.keys) != 0 {
+			var err error
+			if recs, err = n.signZone(recs, time.Now().UTC()); err != nil {
+				n.Log.Warningf("couldn't sign zone '%s': %s", soa.Hdr.Name, err.Error())
+				return
+			}
+		}
+		sendChunks(ch, recs)
+	}()
+
+	return ch
+}
+
+// refreshJournal updates the zone journal with the current zone state.
+func (n NNS) refreshJournal() ([]dns.RR, error) {
+	return n.zoneTransfers(n.zone())
+}
+
+// withContext returns the plugin which contract calls are abandoned once ctx is done.
+func (n NNS) withContext(ctx context.Context) NNS {
+	contracts := make([]*contract.Contract, len(n.Contracts))
+	for i, nnsContract := range n.Contracts {
+		contracts[i] = nnsContract.WithContext(ctx)
+	}
+	n.Contracts = contracts
+	return n
+}
+
 func (n *NNS) setDNSDomain(name string) {
 	n.dnsDomain = strings.Trim(name, dot)
 }
 
-func (n NNS) resolveRecords(state request.Request) ([]dns.RR, error) {
-	var err error
+// resolve looks up records in the cache (if enabled) and in the contracts on miss.
+func (n NNS) resolve(ctx context.Context, state request.Request) (*response, error) {
+	if n.cache == nil {
+		return n.resolveRecords(ctx, state)
+	}
+
+	server := metrics.WithServer(ctx)
+	cacheRequests.WithLabelValues(server).Inc()
+	if res, ok := n.cache.Get(state); ok {
+		if len(res.Answer) == 0 {
+			cacheHits.WithLabelValues(server, hitDenial).Inc()
+		} else {
+			cacheHits.WithLabelValues(server, hitSuccess).Inc()
+		}
+		return res, nil
+	}
+	cacheMisses.WithLabelValues(server).Inc()
+
+	version := n.cache.Version()
+	res, err := n.resolveRecords(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if !res.external {
+		names := n.nnsNames(n.zone())
+		for _, name := range res.names {
+			names = append(names, n.nnsNames(name)...)
+		}
+		n.cache.Add(state, version, names, res)
+	}
+
+	return res, nil
+}
+
+// nnsNames returns names the request name is mapped to in each contract.
+func (n NNS) nnsNames(name string) []string {
+	names := make([]string, len(n.Contracts))
+	for i, nnsContract := range n.Contracts {
+		names[i] = nnsContract.PrepareName(name, n.dnsDomain)
+	}
+	return names
+}
+
+// zone returns the zone apex the plugin is authoritative for.
+func (n NNS) zone() string {
+	return dns.Fqdn(n.dnsDomain)
+}
+
+// resolveRecords forms the response. Records of non-existent names are synthesized from the wildcard
+// at the closest encloser. CNAME chain is followed if the name has no records of the requested type,
+// targets outside the zone are resolved via upstream. If there are no records of the requested type,
+// NODATA or NXDOMAIN response with the zone SOA in the authority section is formed.
+func (n NNS) resolveRecords(ctx context.Context, state request.Request) (*response, error) {
+	var soa *dns.SOA
+	ttl := n.ttl
+	if !n.ttlOverride {
+		if soa = n.lookupSOA(); soa != nil {
+			ttl = soa.Minttl
+		}
+	}
+
+	if n.denial != denialNone {
+		cut, ns, err := n.zoneCut(state.QName(), state.QClass(), ttl)
+		if err != nil {
+			return nil, err
+		}
+		// DS records of the cut are authoritative data of the zone.
+		if cut != "" && !(state.QType() == dns.TypeDS && strings.EqualFold(cut, state.QName())) {
+			return n.referral(state.QName(), cut, ns, state.QClass(), ttl)
+		}
+	}
+
+	res := &response{Rcode: dns.RcodeSuccess}
+	name := state.QName()
+	visited := make(map[string]struct{})
+	var source string
+
+	for i := 0; ; i++ {
+		res.names = append(res.names, name)
+		visited[strings.ToLower(name)] = struct{}{}
+
+		answer, err := n.resolveAnswer(name, state.QType(), state.QClass(), ttl)
+		if err != nil {
+			return nil, err
+		}
+		if len(answer) != 0 {
+			res.Answer = append(res.Answer, answer...)
+			return res, nil
+		}
+
+		// The name has no records of the requested type, it can be an alias, a name covered
+		// by a wildcard or doesn't exist at all. The rcode is set according to the last name
+		// in the chain, see RFC 6604.
+		source, err = n.sourceName(name, res)
+		if err != nil {
+			return nil, err
+		}
+		if source == "" {
+			res.Rcode = dns.RcodeNameError
+			break
+		}
+		if source != name {
+			answer, err = n.resolveAnswer(source, state.QType(), state.QClass(), ttl)
+			if err != nil {
+				return nil, err
+			}
+			if len(answer) != 0 {
+				res.Answer = append(res.Answer, synthesize(answer, name)...)
+				return res, nil
+			}
+		}
+		if state.QType() == dns.TypeCNAME {
+			break
+		}
+
+		cnames, err := n.resolveAnswer(source, dns.TypeCNAME, state.QClass(), ttl)
+		if err != nil {
+			return nil, err
+		}
+		if len(cnames) == 0 {
+			break
+		}
+		res.Answer = append(res.Answer, synthesize(cnames[:1], name)...)
+
+		target := cnames[0].(*dns.CNAME).Target
+		if !dns.IsSubDomain(n.zone(), target) {
+			n.lookupExternal(ctx, state, target, res)
+			return res, nil
+		}
+
+		if _, ok := visited[strings.ToLower(target)]; ok {
+			n.Log.Warningf("cname loop for '%s' at '%s'", state.QName(), target)
+			return res, nil
+		}
+		if i >= maxChain {
+			n.Log.Warningf("cname chain for '%s' is too long", state.QName())
+			return res, nil
+		}
+		name = target
+	}
+
+	if soa == nil {
+		soa = n.lookupSOA()
+	}
+	if soa != nil {
+		res.Ns = []dns.RR{soa}
+	}
+
+	if n.denial != denialNone {
+		var types []uint16
+		if source != "" {
+			var err error
+			if types, err = n.types(source); err != nil {
+				return nil, err
+			}
+		}
+		res.denial = n.denialRecord(name, types, ttl)
+	}
+
+	return res, nil
+}
+
+// sourceName returns the name the records for the name are taken from: the name itself if it exists
+// (including empty non-terminals), the wildcard at the closest encloser if the name doesn't exist
+// but is covered by it (RFC 4592), or empty string if the name doesn't exist at all.
+// The checked wildcard names are added to the response names.
+func (n NNS) sourceName(name string, res *response) (string, error) {
+	// The name, its ancestors in the zone and their wildcards are checked at once.
+	names := []string{name}
+	zone := n.zone()
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		encloser := name[off:]
+		if !dns.IsSubDomain(zone, encloser) {
+			break
+		}
+		names = append(names, encloser, "*."+encloser)
+	}
+
+	exists, err := n.namesExist(names)
+	if err != nil || exists[0] {
+		return name, err
+	}
+
+	for i := 1; i < len(names); i += 2 {
+		if !exists[i] {
+			continue
+		}
+
+		// The closest encloser is found, only its wildcard can cover the name.
+		wildcard := names[i+1]
+		res.names = append(res.names, wildcard)
+		if !exists[i+1] {
+			return "", nil
+		}
+		return wildcard, nil
+	}
+
+	return "", nil
+}
+
+// synthesize returns copies of the records with the owner name replaced.
+func synthesize(rrs []dns.RR, name string) []dns.RR {
+	res := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		res[i] = dns.Copy(rr)
+		res[i].Header().Name = name
+	}
+	return res
+}
+
+// lookupExternal resolves CNAME target outside the zone via upstream.
+func (n NNS) lookupExternal(ctx context.Context, state request.Request, target string, res *response) {
+	res.external = true
+	if n.Upstream == nil {
+		return
+	}
+
+	m, err := n.Upstream.Lookup(ctx, state, target, state.QType())
+	if err != nil {
+		n.Log.Debugf("couldn't resolve cname target '%s' via upstream: %s", target, err.Error())
+		return
+	}
+	if m == nil {
+		return
+	}
+
+	res.Answer = append(res.Answer, m.Answer...)
+	res.Rcode = m.Rcode
+	if m.Rcode == dns.RcodeNameError || (m.Rcode == dns.RcodeSuccess && len(m.Answer) == 0) {
+		res.Ns = m.Ns
+	}
+}
+
+// resolveAnswer resolves records in the contracts according to the merge policy.
+// Failed contracts are skipped, an error is returned only if all of them fail.
+func (n NNS) resolveAnswer(name string, qtype, qclass uint16, ttl uint32) ([]dns.RR, error) {
+	var lastErr error
 	var result []dns.RR
+	var resolved bool
 
-	for _, nnsContract := range n.Contracts {
-		result, err = n.resolveContractRecords(nnsContract, state)
+	for _, nnsContract := range n.orderedContracts() {
+		records, err := n.resolveContractRecords(nnsContract, name, qtype, qclass, ttl)
 		if err != nil {
 			n.Log.Warningf("resolve in contract '%s': %s", nnsContract.Hash().StringLE(), err.Error())
+			lastErr = err
+			continue
+		}
+		resolved = true
+		if len(records) == 0 {
+			continue
+		}
+
+		n.Log.Debugf("'%s' (type %s) is resolved by contract '%s'", name, dns.Type(qtype), nnsContract.Hash().StringLE())
+		if n.merge != mergeUnion {
+			return records, nil
 		}
+		result = unionRRs(result, records)
+	}
+
+	if !resolved {
+		return nil, lastErr
 	}
 
 	return result, nil
 }
 
-func (n NNS) resolveContractRecords(nnsContract *contract.Contract, state request.Request) ([]dns.RR, error) {
-	name := nnsContract.PrepareName(state.QName(), n.dnsDomain)
+func (n NNS) resolveContractRecords(nnsContract *contract.Contract, qname string, qtype, qclass uint16, ttl uint32) ([]dns.RR, error) {
+	name := nnsContract.PrepareName(qname, n.dnsDomain)
 
-	nnsType, err := getNNSType(state)
+	nnsType, err := toNNSType(qtype)
+	if qtype == dns.TypeCAA {
+		nnsType, err = nns.TXT, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot resolve '%s' (type %d) as '%s': %w",
-			state.QName(), state.QType(), name, err)
+		// Such records can't be stored in the contract.
+		return nil, nil
 	}
 
-	resolved, err := nnsContract.Resolve(name, nnsType)
+	nnsContract, err = n.delegate(nnsContract, name)
 	if err != nil {
 		return nil, fmt.Errorf("cannot resolve '%s' (type %d) as '%s': %w",
-			state.QName(), state.QType(), name, err)
+			qname, qtype, name, err)
 	}
 
-	hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: state.QClass(), Ttl: 0}
-	res, err := formResRecords(hdr, resolved)
+	// Records are requested without following CNAME as 'resolve' method does,
+	// the chain is followed by the plugin.
+	resolved, err := nnsContract.GetRecords(name, nnsType)
+	if errors.Is(err, contract.ErrFault) {
+		// The domain isn't registered.
+		return nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot resolve '%s' (type %d) as '%s': %w",
-			state.QName(), state.QType(), name, err)
+			qname, qtype, name, err)
 	}
 
+	hdr := dns.RR_Header{Name: qname, Rrtype: qtype, Class: qclass, Ttl: ttl}
+	var res []dns.RR
+	if qtype == dns.TypeCAA {
+		for _, data := range resolved {
+			if rec := n.formCAARec(data, hdr); rec != nil {
+				res = append(res, rec)
+			}
+		}
+	} else if res, err = formResRecords(hdr, resolved); err != nil {
+		return nil, fmt.Errorf("cannot resolve '%s' (type %d) as '%s': %w",
+			qname, qtype, name, err)
+	}
+	n.dnsNames(nnsContract, res, false)
+
 	return res, nil
 }
 
+// delegate returns the contract the name is delegated to if delegation is enabled.
+func (n NNS) delegate(nnsContract *contract.Contract, name string) (*contract.Contract, error) {
+	if !n.delegation {
+		return nnsContract, nil
+	}
+	return nnsContract.Delegate(name)
+}
+
+// namesExist checks which of the names have records of any type in any contract. An error is returned
+// if any name can't be checked in all of them.
+func (n NNS) namesExist(qnames []string) ([]bool, error) {
+	var (
+		lastErr  error
+		res      = make([]bool, len(qnames))
+		resolved = make([]bool, len(qnames))
+	)
+	for _, nnsContract := range n.Contracts {
+		// Names delegated to the same contract are checked together.
+		type group struct {
+			delegate *contract.Contract
+			indices  []int
+			names    []string
+		}
+		var groups []*group
+		for i, qname := range qnames {
+			name := nnsContract.PrepareName(qname, n.dnsDomain)
+			delegate, err := n.delegate(nnsContract, name)
+			if err != nil {
+				n.Log.Warningf("check name '%s' in contract '%s': %s", name, nnsContract.Hash().StringLE(), err.Error())
+				lastErr = err
+				continue
+			}
+
+			var g *group
+			for _, other := range groups {
+				if other.delegate.Hash().Equals(delegate.Hash()) {
+					g = other
+					break
+				}
+			}
+			if g == nil {
+				g = &group{delegate: delegate}
+				groups = append(groups, g)
+			}
+			g.indices = append(g.indices, i)
+			g.names = append(g.names, name)
+		}
+
+		for _, g := range groups {
+			exists, err := g.delegate.NamesExist(g.names)
+			if err != nil {
+				n.Log.Warningf("check names %v in contract '%s': %s", g.names, nnsContract.Hash().StringLE(), err.Error())
+				lastErr = err
+				continue
+			}
+			for j, i := range g.indices {
+				resolved[i] = true
+				res[i] = res[i] || exists[j]
+			}
+		}
+	}
+
+	for i := range qnames {
+		if !resolved[i] {
+			return nil, lastErr
+		}
+	}
+	return res, nil
+}
+
+// lookupSOA returns SOA record of the zone apex or nil if it can't be got. The SOA served by the journal
+// is used if it's enabled, otherwise the SOA is cached until a new block (if the cache is enabled).
+func (n NNS) lookupSOA() *dns.SOA {
+	if n.journal != nil {
+		if soa := n.journal.SOA(); soa != nil {
+			return soa
+		}
+	}
+
+	var version uint64
+	if n.cache != nil {
+		if soa, ok := n.cache.SOA(n.zone()); ok {
+			return soa
+		}
+		version = n.cache.Version()
+	}
+
+	soa, err := n.zoneSOA()
+	if err != nil {
+		n.Log.Debugf("couldn't get soa of zone '%s': %s", n.zone(), err.Error())
+		return nil
+	}
+	if n.cache != nil {
+		n.cache.AddSOA(n.zone(), version, n.nnsNames(n.zone()), soa)
+	}
+	return soa
+}
+
+// zoneSOA returns SOA record of the zone apex from the first contract that has it.
+// It returns nil if no contract has one.
+func (n NNS) zoneSOA() (*dns.SOA, error) {
+	var lastErr error
+	for _, nnsContract := range n.Contracts {
+		name := nnsContract.PrepareName(n.zone(), n.dnsDomain)
+		records, err := nnsContract.GetRecords(name, nns.RecordType(dns.TypeSOA))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		soa, err := parseSoaRecord(dns.RR_Header{Name: appendRoot(name), Class: dns.ClassINET}, records[0])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		n.dnsNames(nnsContract, []dns.RR{soa}, false)
+		soa.Hdr.Name = n.zone()
+
+		return soa, nil
+	}
+
+	return nil, lastErr
+}
+
+// zoneTransfers gets all zone records from the contracts and merges them according to the merge policy.
+// Names of the records are mapped to the DNS zone.
 func (n NNS) zoneTransfers(zone string) ([]dns.RR, error) {
 	result := make(map[string]*Records)
-	for i, nnsContract := range n.Contracts {
-		transferRecords, err := n.allTransferRecords(nnsContract, zone, i == 0)
+	for _, nnsContract := range n.orderedContracts() {
+		first := nnsContract == n.Contracts[0]
+		transferRecords, err := n.allTransferRecords(nnsContract, zone, first)
 		if err != nil {
 			n.Log.Warningf("get all records in contract '%s': %s", nnsContract.Hash().StringLE(), err.Error())
+			continue
 		}
 
-		for key, recs := range transferRecords {
-			result[key] = recs
-		}
+		n.Log.Debugf("zone '%s' has %d record sets in contract '%s'", zone, len(transferRecords), nnsContract.Hash().StringLE())
+		n.mergeRecords(result, transferRecords, first)
 	}
 
-	return formZoneTransfer(result)
+	records, err := n.formZoneTransfer(result)
+	if err != nil {
+		return nil, err
+	}
+	// The closing SOA is the same record as the opening one.
+	n.dnsNames(n.Contracts[0], records[:len(records)-1], false)
+	return records, nil
 }
 
 func (n NNS) allTransferRecords(nnsContract *contract.Contract, zone string, needSOA bool) (map[string]*Records, error) {
@@ -150,7 +876,7 @@ func (n NNS) allTransferRecords(nnsContract *contract.Contract, zone string, nee
 
 	result := make(map[string]*Records)
 	for _, record := range records {
-		updatedName := appendRoot(record.Name)
+		updatedName := nnsContract.DNSName(record.Name, n.dnsDomain)
 		key := recKey(updatedName, record.Type)
 		recs := result[key]
 		if recs == nil {
@@ -161,11 +887,15 @@ func (n NNS) allTransferRecords(nnsContract *contract.Contract, zone string, nee
 			}
 		}
 		recs.Data = append(recs.Data, record.Data)
+		recs.TTLs = append(recs.TTLs, record.TTL)
 		result[key] = recs
 	}
 
 	if needSOA {
-		soaRecs := result[recKey(appendRoot(name), nns.RecordType(dns.TypeSOA))]
+		soaRecs := result[recKey(nnsContract.DNSName(name, n.dnsDomain), nns.RecordType(dns.TypeSOA))]
+		if soaRecs == nil {
+			return nil, errors.New("zone has no soa record")
+		}
 		if len(soaRecs.Data) != 1 {
 			return nil, fmt.Errorf("invalid number of soa records: %d", len(soaRecs.Data))
 		}
@@ -178,7 +908,9 @@ func recKey(name string, recType nns.RecordType) string {
 	return name + strconv.Itoa(int(recType))
 }
 
-func formZoneTransfer(recordsMap map[string]*Records) ([]dns.RR, error) {
+// formZoneTransfer forms AXFR records. Record TTL is the configured one, if it's not set
+// the TTL stored in the contract is used, otherwise the zone SOA minimum.
+func (n NNS) formZoneTransfer(recordsMap map[string]*Records) ([]dns.RR, error) {
 	if len(recordsMap) == 0 {
 		return nil, fmt.Errorf("records must not be empty")
 	}
@@ -197,27 +929,47 @@ func formZoneTransfer(recordsMap map[string]*Records) ([]dns.RR, error) {
 
 	var err error
 	var soaRecord *dns.SOA
-	results := make([]dns.RR, 1, len(records))
-
 	for _, recs := range records {
 		if recs.Type == nns.RecordType(dns.TypeSOA) {
 			soaRecord, err = formSoaRecord(recs)
 			if err != nil {
 				return nil, err
 			}
+			break
+		}
+	}
+	if soaRecord == nil {
+		return nil, fmt.Errorf("soa record is missing")
+	}
+
+	results := make([]dns.RR, 1, len(records))
+	for _, recs := range records {
+		if recs.Type == nns.RecordType(dns.TypeSOA) {
 			continue
 		}
 
-		for _, data := range recs.Data {
-			rec, err := formRec(uint16(recs.Type), data, dns.RR_Header{
+		for i, data := range recs.Data {
+			var ttl uint32
+			if i < len(recs.TTLs) {
+				ttl = recs.TTLs[i]
+			}
+
+			hdr := dns.RR_Header{
 				Name:   recs.Name,
 				Rrtype: uint16(recs.Type),
 				Class:  dns.ClassINET,
-			})
+				Ttl:    n.transferTTL(soaRecord, ttl),
+			}
+			rec, err := formRec(uint16(recs.Type), data, hdr)
 			if err != nil {
 				return nil, err
 			}
 			results = append(results, rec)
+			if recs.Type == nns.TXT {
+				if caa := n.formCAARec(data, hdr); caa != nil {
+					results = append(results, caa)
+				}
+			}
 		}
 	}
 
@@ -227,6 +979,17 @@ func formZoneTransfer(recordsMap map[string]*Records) ([]dns.RR, error) {
 	return results, nil
 }
 
+// transferTTL returns TTL of the zone transfer record with the TTL stored in the contract.
+func (n NNS) transferTTL(soa *dns.SOA, ttl uint32) uint32 {
+	if n.ttlOverride {
+		return n.ttl
+	}
+	if ttl != 0 {
+		return ttl
+	}
+	return soa.Minttl
+}
+
 func formSoaRecord(rec *Records) (*dns.SOA, error) {
 	if rec.Type != nns.RecordType(dns.TypeSOA) {
 		return nil, fmt.Errorf("invalid type for soa record")
@@ -236,14 +999,20 @@ func formSoaRecord(rec *Records) (*dns.SOA, error) {
 		return nil, fmt.Errorf("invalid len for soa record")
 	}
 
-	split := strings.Split(rec.Data[0], " ")
+	return parseSoaRecord(dns.RR_Header{Name: rec.Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET}, rec.Data[0])
+}
+
+// parseSoaRecord parses the NNS representation of the SOA record:
+// 'name email serial refresh retry expire ttl'.
+func parseSoaRecord(hdr dns.RR_Header, data string) (*dns.SOA, error) {
+	split := strings.Split(data, " ")
 	if len(split) != 7 {
-		return nil, fmt.Errorf("invalid soa record: %s", rec.Data[0])
+		return nil, fmt.Errorf("invalid soa record: %s", data)
 	}
 
 	name := appendRoot(split[0])
-	if rec.Name != name {
-		return nil, fmt.Errorf("invalid soa record, mismatched names: %s %s", rec.Name, name)
+	if !strings.EqualFold(hdr.Name, name) {
+		return nil, fmt.Errorf("invalid soa record, mismatched names: %s %s", hdr.Name, name)
 	}
 
 	lenSerial := len(split[2])
@@ -271,13 +1040,11 @@ func formSoaRecord(rec *Records) (*dns.SOA, error) {
 		return nil, fmt.Errorf("invalid soa record, invalid ttl: %s", split[6])
 	}
 
+	hdr.Rrtype = dns.TypeSOA
+	hdr.Ttl = ttl
+
 	return &dns.SOA{
-		Hdr: dns.RR_Header{
-			Name:   name,
-			Rrtype: dns.TypeSOA,
-			Class:  dns.ClassINET,
-			Ttl:    ttl,
-		},
+		Hdr:     hdr,
 		Ns:      name,
 		Mbox:    strings.ReplaceAll(appendRoot(split[1]), "@", "."),
 		Serial:  serial,
@@ -303,18 +1070,17 @@ func parseUint32(data string) (uint32, error) {
 	return uint32(parsed), nil
 }
 
-func getNNSType(req request.Request) (nns.RecordType, error) {
-	switch req.QType() {
-	case dns.TypeTXT:
-		return nns.TXT, nil
-	case dns.TypeA:
-		return nns.A, nil
-	case dns.TypeAAAA:
-		return nns.AAAA, nil
-	case dns.TypeCNAME:
-		return nns.CNAME, nil
+// caaPrefix is the prefix of the TXT records keeping CAA records, e.g. 'caa=0 issue "letsencrypt.org"'.
+const caaPrefix = "caa="
+
+// toNNSType converts DNS type to the NNS one. NNS contract stores record type
+// as a single byte, so types with greater codes (e.g. CAA) can't be kept there,
+// CAA records are kept in TXT ones with caaPrefix instead.
+func toNNSType(qtype uint16) (nns.RecordType, error) {
+	if qtype == 0 || qtype > math.MaxUint8 {
+		return 0, fmt.Errorf("unsupported record type: %s", dns.Type(qtype))
 	}
-	return 0, fmt.Errorf("usupported record type: %s", dns.Type(req.QType()))
+	return nns.RecordType(qtype), nil
 }
 
 func formResRecords(hdr dns.RR_Header, resolved []string) ([]dns.RR, error) {
@@ -338,8 +1104,41 @@ func formRec(reqType uint16, res string, hdr dns.RR_Header) (dns.RR, error) {
 	case dns.TypeAAAA:
 		return &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(res)}, nil
 	case dns.TypeCNAME:
-		return &dns.CNAME{Hdr: hdr, Target: res}, nil
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(res)}, nil
+	case dns.TypeSOA:
+		return parseSoaRecord(hdr, res)
+	}
+
+	return parseRec(reqType, res, hdr)
+}
+
+// formCAARec forms CAA record from the data of the TXT record keeping it. Nil is returned
+// if the data doesn't have caaPrefix or is invalid, such records are served only as TXT.
+func (n NNS) formCAARec(data string, hdr dns.RR_Header) dns.RR {
+	if !strings.HasPrefix(data, caaPrefix) {
+		return nil
+	}
+	hdr.Rrtype = dns.TypeCAA
+	rec, err := parseRec(dns.TypeCAA, strings.TrimPrefix(data, caaPrefix), hdr)
+	if err != nil {
+		n.Log.Warningf("skip TXT record of '%s' with invalid CAA data: %s", hdr.Name, err.Error())
+		return nil
+	}
+	return rec
+}
+
+// parseRec forms record of any other type (MX, SRV, NS, PTR, etc.)
+// from its presentation format, e.g. '10 mail.example.org.' for MX.
+// Unknown types can be stored using RFC 3597 '\# 4 0a000001' notation.
+func parseRec(reqType uint16, res string, hdr dns.RR_Header) (dns.RR, error) {
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d %s %s %s",
+		hdr.Name, hdr.Ttl, dns.Class(hdr.Class), dns.Type(reqType), res))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s record '%s': %w", dns.Type(reqType), res, err)
+	}
+	if rr == nil || rr.Header().Rrtype != reqType {
+		return nil, fmt.Errorf("invalid %s record '%s'", dns.Type(reqType), res)
 	}
 
-	return nil, fmt.Errorf("usupported record type: %s", dns.Type(reqType))
+	return rr, nil
 }
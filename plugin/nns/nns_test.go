@@ -2,12 +2,19 @@ package nns
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin/nns/contract"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/miekg/dns"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neofs-contract/nns"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,7 +24,7 @@ func TestGetNetmapHash(t *testing.T) {
 	defer container.Terminate(ctx)
 
 	prm := &contract.Params{
-		Endpoint: "http://localhost:30333",
+		Endpoints: []string{"http://localhost:30333"},
 	}
 	nnsContract, err := contract.NewContract(ctx, prm)
 	require.NoError(t, err)
@@ -94,8 +101,8 @@ func TestGetNetmapHash(t *testing.T) {
 				nnsPlugin.setDNSDomain(tc.dnsDomain)
 
 				contractPrm := &contract.Params{
-					Endpoint: prm.Endpoint,
-					Domain:   tc.nnsDomain,
+					Endpoints: prm.Endpoints,
+					Domain:    tc.nnsDomain,
 				}
 				contractNNS, err := contract.NewContract(ctx, contractPrm)
 				require.NoError(t, err)
@@ -106,3 +113,482 @@ func TestGetNetmapHash(t *testing.T) {
 		}
 	})
 }
+
+func TestFormRec(t *testing.T) {
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: "test.neofs.", Rrtype: rrtype, Class: dns.ClassINET}
+	}
+
+	for _, tc := range []struct {
+		rrtype   uint16
+		data     string
+		expected string
+		valid    bool
+	}{
+		{rrtype: dns.TypeA, data: "10.0.0.1", expected: "test.neofs.\t0\tIN\tA\t10.0.0.1", valid: true},
+		{rrtype: dns.TypeTXT, data: "some text", expected: "test.neofs.\t0\tIN\tTXT\t\"some text\"", valid: true},
+		{rrtype: dns.TypeMX, data: "10 mail.neofs.", expected: "test.neofs.\t0\tIN\tMX\t10 mail.neofs.", valid: true},
+		{rrtype: dns.TypeSRV, data: "0 5 8080 node.neofs", expected: "test.neofs.\t0\tIN\tSRV\t0 5 8080 node.neofs.", valid: true},
+		{rrtype: dns.TypeNS, data: "ns1.neofs.", expected: "test.neofs.\t0\tIN\tNS\tns1.neofs.", valid: true},
+		{rrtype: dns.TypePTR, data: "node.neofs.", expected: "test.neofs.\t0\tIN\tPTR\tnode.neofs.", valid: true},
+		{rrtype: dns.TypeSOA, data: "test.neofs ops@neofs 1652101919 3600 600 604800 300", expected: "test.neofs.\t300\tIN\tSOA\ttest.neofs. ops.neofs. 1652101919 3600 600 604800 300", valid: true},
+		{rrtype: dns.TypeMX, data: "mail.neofs.", valid: false},
+		{rrtype: dns.TypeSRV, data: "0 5 node.neofs", valid: false},
+	} {
+		t.Run(dns.Type(tc.rrtype).String(), func(t *testing.T) {
+			rec, err := formRec(tc.rrtype, tc.data, hdr(tc.rrtype))
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, rec.String())
+		})
+	}
+}
+
+func TestToNNSType(t *testing.T) {
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeMX, dns.TypeSRV, dns.TypeNS, dns.TypePTR} {
+		nnsType, err := toNNSType(qtype)
+		require.NoError(t, err)
+		require.EqualValues(t, qtype, nnsType)
+	}
+
+	_, err := toNNSType(dns.TypeCAA)
+	require.Error(t, err)
+}
+
+func TestCAA(t *testing.T) {
+	n := newStaticNNS(
+		contract.Record{Name: "a." + testZone, Type: nns.TXT, Data: "caa=0 issue \"letsencrypt.org\""},
+		contract.Record{Name: "a." + testZone, Type: nns.TXT, Data: "caa=invalid"},
+		contract.Record{Name: "a." + testZone, Type: nns.TXT, Data: "text"},
+		contract.Record{Name: "b." + testZone, Type: nns.TXT, Data: "text"},
+	)
+	soa := test.SOA("example.neofs. 300 IN SOA example.neofs. ops.neofs. 1 3600 600 604800 300")
+	caa, err := dns.NewRR("a.example.neofs. 300 IN CAA 0 issue \"letsencrypt.org\"")
+	require.NoError(t, err)
+
+	for _, tc := range []test.Case{
+		{Qname: "a." + testZone, Qtype: dns.TypeCAA, Answer: []dns.RR{caa}},
+		{Qname: "a." + testZone, Qtype: dns.TypeTXT, Answer: []dns.RR{
+			&dns.TXT{Hdr: dns.RR_Header{Name: "a.example.neofs.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+				Txt: []string{"caa=0 issue \"letsencrypt.org\""}},
+			test.TXT("a.example.neofs. 300 IN TXT \"caa=invalid\""),
+			test.TXT("a.example.neofs. 300 IN TXT \"text\""),
+		}},
+		{Qname: "b." + testZone, Qtype: dns.TypeCAA, Ns: []dns.RR{soa}},
+	} {
+		t.Run(dns.Type(tc.Qtype).String()+" "+tc.Qname, func(t *testing.T) {
+			require.NoError(t, test.SortAndCheck(serve(t, n, tc), tc))
+		})
+	}
+
+	types, err := n.types("a." + testZone + ".")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []uint16{dns.TypeTXT, dns.TypeCAA}, types)
+
+	types, err = n.types("b." + testZone + ".")
+	require.NoError(t, err)
+	require.Equal(t, []uint16{dns.TypeTXT}, types)
+
+	res, err := n.zoneTransfers(testZone + ".")
+	require.NoError(t, err)
+	var transferred []dns.RR
+	for _, rec := range res {
+		if rec.Header().Rrtype == dns.TypeCAA {
+			transferred = append(transferred, rec)
+		}
+	}
+	require.Len(t, transferred, 1)
+	require.Equal(t, caa.String(), transferred[0].String())
+}
+
+func TestFormZoneTransfer(t *testing.T) {
+	records := map[string]*Records{
+		recKey("neofs.", nns.RecordType(dns.TypeSOA)): {
+			Name: "neofs.",
+			Type: nns.RecordType(dns.TypeSOA),
+			Data: []string{"neofs ops@neofs 1652101919 3600 600 604800 300"},
+			TTLs: []uint32{0},
+		},
+		recKey("test.neofs.", nns.A): {
+			Name: "test.neofs.",
+			Type: nns.A,
+			Data: []string{"10.0.0.1", "10.0.0.2"},
+			TTLs: []uint32{0, 60},
+		},
+	}
+
+	t.Run("soa minimum and record ttl", func(t *testing.T) {
+		res, err := NNS{}.formZoneTransfer(records)
+		require.NoError(t, err)
+		require.Len(t, res, 4)
+		require.Equal(t, dns.TypeSOA, res[0].Header().Rrtype)
+		require.EqualValues(t, 300, res[1].Header().Ttl)
+		require.EqualValues(t, 60, res[2].Header().Ttl)
+		require.Equal(t, dns.TypeSOA, res[3].Header().Rrtype)
+	})
+
+	t.Run("configured ttl", func(t *testing.T) {
+		res, err := NNS{ttl: 30, ttlOverride: true}.formZoneTransfer(records)
+		require.NoError(t, err)
+		require.Len(t, res, 4)
+		require.EqualValues(t, 30, res[1].Header().Ttl)
+		require.EqualValues(t, 30, res[2].Header().Ttl)
+	})
+}
+
+func TestSendChunks(t *testing.T) {
+	recs := make([]dns.RR, 2*transferChunkSize+1)
+	for i := range recs {
+		recs[i] = test.A("a.neofs. 60 IN A 10.0.0.1")
+	}
+
+	ch := make(chan []dns.RR, 4)
+	sendChunks(ch, recs)
+	close(ch)
+
+	var sizes []int
+	for chunk := range ch {
+		sizes = append(sizes, len(chunk))
+	}
+	require.Equal(t, []int{transferChunkSize, transferChunkSize, 1}, sizes)
+}
+
+// testZone is the zone served from the contract in memory.
+const testZone = "example.neofs"
+
+var testHash = util.Uint160{1}
+
+// newStaticNNS returns the plugin serving the test zone from the records of the contract in memory.
+// The zone SOA is added to the records.
+func newStaticNNS(records ...contract.Record) NNS {
+	return newChainNNS(newTestChain(records...))
+}
+
+// newChainNNS returns the plugin serving the test zone from the contract in the chain.
+func newChainNNS(chain *testChain) NNS {
+	nnsContract := contract.NewWithChain(&contract.Params{ContractHash: testHash}, chain)
+
+	return NNS{
+		Next:      test.NextHandler(dns.RcodeSuccess, nil),
+		Contracts: []*contract.Contract{nnsContract},
+		Log:       clog.NewWithPlugin(pluginName),
+		dnsDomain: testZone,
+	}
+}
+
+// testChain answers the calls from the records of the contract with testHash in memory. Like in the
+// contract, the domain is registered if there are records of it or its subdomains.
+type testChain struct {
+	mtx     sync.RWMutex
+	height  uint32
+	records []contract.Record
+}
+
+// newTestChain returns the chain with the records and the zone SOA.
+func newTestChain(records ...contract.Record) *testChain {
+	records = append([]contract.Record{{
+		Name: testZone,
+		Type: nns.RecordType(dns.TypeSOA),
+		Data: testZone + " ops@neofs 1 3600 600 604800 300",
+	}}, records...)
+	return &testChain{height: 1, records: records}
+}
+
+// SetRecords replaces the records of the contract and persists a new block.
+func (c *testChain) SetRecords(records []contract.Record) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.records = records
+	c.height++
+}
+
+func (c *testChain) BlockCount() (uint32, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.height, nil
+}
+
+func (c *testChain) GetRecords(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error) {
+	records, err := c.domainRecords(hash, name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for _, rec := range records {
+		if rec.Type == nnsType && strings.EqualFold(rec.Name, name) {
+			res = append(res, rec.Data)
+		}
+	}
+	return res, nil
+}
+
+// Resolve doesn't follow CNAME records, the plugin resolves names with GetRecords.
+func (c *testChain) Resolve(hash util.Uint160, name string, nnsType nns.RecordType) ([]string, error) {
+	return c.GetRecords(hash, name, nnsType)
+}
+
+func (c *testChain) TraverseAllRecords(hash util.Uint160, name string, f func([]contract.Record) bool) error {
+	records, err := c.domainRecords(hash, name)
+	if err != nil {
+		return err
+	}
+	f(records)
+	return nil
+}
+
+func (c *testChain) HasMethod(hash util.Uint160, _ string, _ int) (bool, error) {
+	return hash.Equals(testHash), nil
+}
+
+// domainRecords returns the records of the domain the name belongs to.
+func (c *testChain) domainRecords(hash util.Uint160, name string) ([]contract.Record, error) {
+	if !hash.Equals(testHash) {
+		return nil, fmt.Errorf("%w: contract '%s' isn't deployed", contract.ErrFault, hash.StringLE())
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	domain := domainName(name)
+	var res []contract.Record
+	for _, rec := range c.records {
+		if strings.EqualFold(domainName(rec.Name), domain) {
+			res = append(res, rec)
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%w: domain '%s' isn't registered", contract.ErrFault, domain)
+	}
+	return res, nil
+}
+
+// domainName returns the second-level domain of the name.
+func domainName(name string) string {
+	labels := strings.Split(name, ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// serve sends the query to the plugin and returns the response.
+func serve(t *testing.T, n NNS, tc test.Case) *dns.Msg {
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err := n.ServeDNS(context.Background(), rec, tc.Msg())
+	require.NoError(t, err)
+	require.NotNil(t, rec.Msg)
+	return rec.Msg
+}
+
+func TestCNAMEChain(t *testing.T) {
+	records := []contract.Record{
+		{Name: "a." + testZone, Type: nns.CNAME, Data: "b." + testZone},
+		{Name: "b." + testZone, Type: nns.CNAME, Data: "c." + testZone},
+		{Name: "c." + testZone, Type: nns.A, Data: "10.0.0.1"},
+		{Name: "x." + testZone, Type: nns.CNAME, Data: "y." + testZone},
+		{Name: "y." + testZone, Type: nns.CNAME, Data: "x." + testZone},
+		{Name: "ext." + testZone, Type: nns.CNAME, Data: "target.example.com"},
+	}
+	long := make([]dns.RR, maxChain+1)
+	for i := 0; i <= maxChain+1; i++ {
+		name := fmt.Sprintf("c%d.%s", i, testZone)
+		records = append(records, contract.Record{Name: name, Type: nns.CNAME, Data: fmt.Sprintf("c%d.%s", i+1, testZone)})
+		if i < len(long) {
+			long[i] = test.CNAME(fmt.Sprintf("%s. 300 IN CNAME c%d.%s.", name, i+1, testZone))
+		}
+	}
+	records = append(records, contract.Record{Name: fmt.Sprintf("c%d.%s", maxChain+2, testZone), Type: nns.A, Data: "10.0.0.2"})
+	n := newStaticNNS(records...)
+
+	for _, tc := range []struct {
+		name string
+		test.Case
+	}{
+		{
+			name: "in-zone chain",
+			Case: test.Case{Qname: "a." + testZone, Qtype: dns.TypeA, Answer: []dns.RR{
+				test.CNAME("a.example.neofs. 300 IN CNAME b.example.neofs."),
+				test.CNAME("b.example.neofs. 300 IN CNAME c.example.neofs."),
+				test.A("c.example.neofs. 300 IN A 10.0.0.1"),
+			}},
+		},
+		{
+			name: "cname query isn't followed",
+			Case: test.Case{Qname: "a." + testZone, Qtype: dns.TypeCNAME, Answer: []dns.RR{
+				test.CNAME("a.example.neofs. 300 IN CNAME b.example.neofs."),
+			}},
+		},
+		{
+			name: "loop",
+			Case: test.Case{Qname: "x." + testZone, Qtype: dns.TypeA, Answer: []dns.RR{
+				test.CNAME("x.example.neofs. 300 IN CNAME y.example.neofs."),
+				test.CNAME("y.example.neofs. 300 IN CNAME x.example.neofs."),
+			}},
+		},
+		{
+			name: "too long chain",
+			Case: test.Case{Qname: "c0." + testZone, Qtype: dns.TypeA, Answer: long},
+		},
+		{
+			name: "out-of-zone target without upstream",
+			Case: test.Case{Qname: "ext." + testZone, Qtype: dns.TypeA, Answer: []dns.RR{
+				test.CNAME("ext.example.neofs. 300 IN CNAME target.example.com."),
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, test.SortAndCheck(serve(t, n, tc.Case), tc.Case))
+		})
+	}
+}
+
+func TestAllTransferRecords(t *testing.T) {
+	records := []contract.Record{{Name: "a." + testZone, Type: nns.A, Data: "10.0.0.1"}}
+	chain := newTestChain(records...)
+	n := newChainNNS(chain)
+
+	res, err := n.allTransferRecords(n.Contracts[0], testZone+".", true)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	chain.SetRecords(records)
+	_, err = n.allTransferRecords(n.Contracts[0], testZone+".", true)
+	require.Error(t, err)
+	_, err = n.zoneTransfers(testZone + ".")
+	require.Error(t, err)
+
+	// Only the first contract must have the SOA.
+	res, err = n.allTransferRecords(n.Contracts[0], testZone+".", false)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+}
+
+func TestStreamTransfer(t *testing.T) {
+	soa := testZone + " ops@neofs 1 3600 600 604800 300"
+	records := []contract.Record{
+		{Name: "a." + testZone, Type: nns.A, Data: "10.0.0.1"},
+		{Name: "b." + testZone, Type: nns.TXT, Data: "text"},
+	}
+
+	// The zone is smaller than a chunk, so aborted transfers send only the opening SOA.
+	transfer := func(n NNS, soaData []string) ([]dns.RR, error) {
+		ch := make(chan []dns.RR, 4)
+		err := n.streamTransfer(ch, testZone+".", soaData)
+		close(ch)
+
+		var res []dns.RR
+		for chunk := range ch {
+			res = append(res, chunk...)
+		}
+		return res, err
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		res, err := transfer(newStaticNNS(records...), []string{soa})
+		require.NoError(t, err)
+		require.Len(t, res, 4)
+		require.Equal(t, dns.TypeSOA, res[0].Header().Rrtype)
+		require.Equal(t, dns.TypeSOA, res[3].Header().Rrtype)
+	})
+
+	t.Run("soa changed", func(t *testing.T) {
+		n := newStaticNNS(records...)
+		res, err := transfer(n, []string{testZone + " ops@neofs 0 3600 600 604800 300"})
+		require.Error(t, err)
+		require.Len(t, res, 1)
+	})
+
+	t.Run("multiple soa", func(t *testing.T) {
+		n := newStaticNNS(append(records, contract.Record{Name: testZone, Type: nns.RecordType(dns.TypeSOA), Data: soa})...)
+		res, err := transfer(n, []string{soa})
+		require.Error(t, err)
+		require.Len(t, res, 1)
+	})
+
+	t.Run("no soa", func(t *testing.T) {
+		chain := newTestChain()
+		n := newChainNNS(chain)
+		chain.SetRecords(records)
+		res, err := transfer(n, []string{soa})
+		require.Error(t, err)
+		require.Len(t, res, 1)
+	})
+}
+
+func TestWildcard(t *testing.T) {
+	n := newStaticNNS(
+		contract.Record{Name: "*." + testZone, Type: nns.TXT, Data: "wildcard"},
+		contract.Record{Name: "*.w." + testZone, Type: nns.A, Data: "10.0.0.3"},
+		contract.Record{Name: "x.ent." + testZone, Type: nns.A, Data: "10.0.0.4"},
+	)
+	soa := test.SOA("example.neofs. 300 IN SOA example.neofs. ops.neofs. 1 3600 600 604800 300")
+
+	for _, tc := range []struct {
+		name string
+		test.Case
+	}{
+		{
+			name: "match",
+			Case: test.Case{Qname: "a.w." + testZone, Qtype: dns.TypeA, Answer: []dns.RR{
+				test.A("a.w.example.neofs. 300 IN A 10.0.0.3"),
+			}},
+		},
+		{
+			name: "match below the closest encloser",
+			Case: test.Case{Qname: "b.a.w." + testZone, Qtype: dns.TypeA, Answer: []dns.RR{
+				test.A("b.a.w.example.neofs. 300 IN A 10.0.0.3"),
+			}},
+		},
+		{
+			name: "match at the apex",
+			Case: test.Case{Qname: "a." + testZone, Qtype: dns.TypeTXT, Answer: []dns.RR{
+				test.TXT("a.example.neofs. 300 IN TXT \"wildcard\""),
+			}},
+		},
+		{
+			name: "nodata",
+			Case: test.Case{Qname: "a.w." + testZone, Qtype: dns.TypeTXT, Ns: []dns.RR{soa}},
+		},
+		{
+			name: "empty non-terminal isn't synthesized",
+			Case: test.Case{Qname: "ent." + testZone, Qtype: dns.TypeTXT, Ns: []dns.RR{soa}},
+		},
+		{
+			name: "closest encloser without wildcard",
+			Case: test.Case{Qname: "a.x.ent." + testZone, Qtype: dns.TypeTXT, Rcode: dns.RcodeNameError, Ns: []dns.RR{soa}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, test.SortAndCheck(serve(t, n, tc.Case), tc.Case))
+		})
+	}
+}
+
+func TestLookupSOA(t *testing.T) {
+	chain := newTestChain()
+	n := newChainNNS(chain)
+	n.cache = newRecordCache(time.Minute, defaultCacheCap)
+	require.EqualValues(t, 1, n.lookupSOA().Serial)
+
+	// The SOA is cached until a new block.
+	chain.SetRecords([]contract.Record{{
+		Name: testZone,
+		Type: nns.RecordType(dns.TypeSOA),
+		Data: testZone + " ops@neofs 2 3600 600 604800 300",
+	}})
+	require.EqualValues(t, 1, n.lookupSOA().Serial)
+	n.cache.Invalidate()
+	require.EqualValues(t, 2, n.lookupSOA().Serial)
+
+	// The SOA served by the journal is preferred.
+	n.journal = newZoneJournal(defaultJournalSize)
+	n.journal.Update([]dns.RR{
+		test.SOA("example.neofs. 300 IN SOA example.neofs. ops.neofs. 5 3600 600 604800 300"),
+		test.SOA("example.neofs. 300 IN SOA example.neofs. ops.neofs. 5 3600 600 604800 300"),
+	}, []uint32{10})
+	require.EqualValues(t, 15, n.lookupSOA().Serial)
+}
@@ -0,0 +1,44 @@
+package nns
+
+import (
+	"time"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+)
+
+// chainPollInterval is the interval of updating chain metrics of the endpoints.
+const chainPollInterval = 10 * time.Second
+
+// Ready implements the ready.Readiness interface. The plugin is ready once every contract has answered.
+func (n NNS) Ready() bool {
+	for _, nnsContract := range n.Contracts {
+		if !nnsContract.Answered() {
+			return false
+		}
+	}
+	return true
+}
+
+// watchChains updates chain metrics of the contract endpoints until stop is closed.
+func watchChains(contracts []*contract.Contract, stop <-chan struct{}) {
+	observe := func() {
+		for _, nnsContract := range contracts {
+			nnsContract.ObserveChain()
+		}
+	}
+
+	go func() {
+		tick := time.NewTicker(chainPollInterval)
+		defer tick.Stop()
+
+		observe()
+		for {
+			select {
+			case <-tick.C:
+				observe()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package nns
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/miekg/dns"
+)
+
+// reverseIndex maps addresses of A and AAAA records of the zone to their names.
+type reverseIndex struct {
+	mtx   sync.RWMutex
+	names map[string][]reverseName
+}
+
+// reverseName is the name an address belongs to with the TTL of its record.
+type reverseName struct {
+	name string
+	ttl  uint32
+}
+
+func newReverseIndex() *reverseIndex {
+	return &reverseIndex{
+		names: make(map[string][]reverseName),
+	}
+}
+
+// isReverse checks whether the name is a reverse name of an address.
+func isReverse(name string) bool {
+	return dnsutil.ExtractAddressFromReverse(name) != ""
+}
+
+// isReverseZone checks whether the zone is the reverse zone.
+func isReverseZone(zone string) bool {
+	return dns.IsSubDomain("in-addr.arpa.", zone) || dns.IsSubDomain("ip6.arpa.", zone)
+}
+
+// reverseRecords returns the zone records the reverse index is built from. If the plugin serves
+// the reverse zone, names are mapped to the zone of the first fixed rewrite rule of the NNS domain,
+// otherwise they are kept as they are stored in the contract.
+func (n NNS) reverseRecords() ([]dns.RR, error) {
+	if !isReverseZone(n.zone()) {
+		return n.zoneTransfers(n.zone())
+	}
+
+	domain := n.Contracts[0].Domain()
+	zone := domain
+	for _, rule := range n.rewrites {
+		if rule.re == nil && rule.domain == domain {
+			zone = rule.zone
+			break
+		}
+	}
+	n.setDNSDomain(zone)
+	return n.zoneTransfers(n.zone())
+}
+
+// Lookup returns PTR records for the reverse name, nil is returned
+// if the address isn't in the index.
+func (r *reverseIndex) Lookup(qname, addr string) []dns.RR {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil
+	}
+
+	r.mtx.RLock()
+	names := r.names[ip.String()]
+	r.mtx.RUnlock()
+
+	answers := make([]dns.RR, 0, len(names))
+	for _, name := range names {
+		answers = append(answers, &dns.PTR{
+			Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: name.ttl},
+			Ptr: name.name,
+		})
+	}
+	return answers
+}
+
+// Update rebuilds the index from the zone records.
+func (r *reverseIndex) Update(records []dns.RR) {
+	names := make(map[string][]reverseName)
+	add := func(ip net.IP, hdr *dns.RR_Header) {
+		addr := ip.String()
+		name := strings.ToLower(hdr.Name)
+		for _, existing := range names[addr] {
+			if existing.name == name {
+				return
+			}
+		}
+		names[addr] = append(names[addr], reverseName{name: name, ttl: hdr.Ttl})
+	}
+
+	for _, rr := range records {
+		switch rec := rr.(type) {
+		case *dns.A:
+			add(rec.A, &rec.Hdr)
+		case *dns.AAAA:
+			add(rec.AAAA, &rec.Hdr)
+		}
+	}
+
+	r.mtx.Lock()
+	r.names = names
+	r.mtx.Unlock()
+}
+
+// Len returns the number of indexed addresses.
+func (r *reverseIndex) Len() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return len(r.names)
+}
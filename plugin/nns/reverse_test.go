@@ -0,0 +1,41 @@
+package nns
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseIndex(t *testing.T) {
+	idx := newReverseIndex()
+	idx.Update([]dns.RR{
+		test.SOA("neofs. 3600 IN SOA ns.neofs. admin.neofs. 10 3600 600 86400 60"),
+		test.A("a.neofs. 60 IN A 10.0.0.1"),
+		test.A("B.neofs. 30 IN A 10.0.0.1"),
+		test.AAAA("a.neofs. 60 IN AAAA ::1"),
+		test.CNAME("c.neofs. 60 IN CNAME a.neofs."),
+	})
+	require.Equal(t, 2, idx.Len())
+
+	answers := idx.Lookup("1.0.0.10.in-addr.arpa.", "10.0.0.1")
+	require.Len(t, answers, 2)
+	require.Equal(t, "a.neofs.", answers[0].(*dns.PTR).Ptr)
+	require.Equal(t, uint32(60), answers[0].Header().Ttl)
+	require.Equal(t, "b.neofs.", answers[1].(*dns.PTR).Ptr)
+	require.Equal(t, "1.0.0.10.in-addr.arpa.", answers[1].Header().Name)
+
+	answers = idx.Lookup("ptr.", "0:0:0:0:0:0:0:1")
+	require.Len(t, answers, 1)
+
+	require.Empty(t, idx.Lookup("2.0.0.10.in-addr.arpa.", "10.0.0.2"))
+	require.Empty(t, idx.Lookup("x.in-addr.arpa.", ""))
+
+	require.True(t, isReverse("1.0.0.10.in-addr.arpa."))
+	require.False(t, isReverse("0.10.in-addr.arpa."))
+	require.False(t, isReverse("a.neofs."))
+
+	idx.Update(nil)
+	require.Equal(t, 0, idx.Len())
+}
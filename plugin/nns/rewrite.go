@@ -0,0 +1,111 @@
+package nns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/miekg/dns"
+)
+
+// rewriteRule maps the DNS zone to the NNS domain.
+type rewriteRule struct {
+	// zone is the fixed DNS zone, re matches the zone for regex rules.
+	zone string
+	re   *regexp.Regexp
+	// domain is the NNS domain, for regex rules it can refer to the captures ($1, ${name}).
+	domain string
+}
+
+// rewriteTable is the list of rules, the first matching one is used.
+type rewriteTable []rewriteRule
+
+func newRewriteRule(zone, domain string) rewriteRule {
+	return rewriteRule{
+		zone:   strings.ToLower(strings.Trim(zone, dot)),
+		domain: strings.Trim(domain, dot),
+	}
+}
+
+func newRegexRewriteRule(expr, template string) (rewriteRule, error) {
+	re, err := regexp.Compile("(?i)^(?:" + strings.TrimSuffix(expr, dot) + ")$")
+	if err != nil {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite regex: %w", err)
+	}
+	return rewriteRule{re: re, domain: strings.Trim(template, dot)}, nil
+}
+
+// match returns the DNS zone (the longest suffix of the name the rule matches) and the NNS domain.
+func (r rewriteRule) match(name string) (string, string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, dot))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		zone := name[off:]
+		if r.re == nil {
+			if zone == r.zone {
+				return zone, r.domain, true
+			}
+			continue
+		}
+		if m := r.re.FindStringSubmatchIndex(zone); m != nil {
+			domain := r.re.ExpandString(nil, r.domain, zone, m)
+			return zone, strings.Trim(string(domain), dot), true
+		}
+	}
+	return "", "", false
+}
+
+// match returns the DNS zone and the NNS domain of the name by the first matching rule.
+func (t rewriteTable) match(name string) (string, string, bool) {
+	for _, rule := range t {
+		if zone, domain, ok := rule.match(name); ok {
+			return zone, domain, true
+		}
+	}
+	return "", "", false
+}
+
+// withRewrite returns the plugin serving the DNS zone mapped to the NNS domain.
+// The zone journal and snapshot are kept only for the configured zone.
+func (n NNS) withRewrite(zone, domain string) NNS {
+	if zone != n.dnsDomain {
+		n.journal = nil
+		n.snapshot = nil
+	}
+
+	contracts := make([]*contract.Contract, len(n.Contracts))
+	for i, nnsContract := range n.Contracts {
+		contracts[i] = nnsContract.WithDomain(domain)
+	}
+	n.Contracts = contracts
+	n.setDNSDomain(zone)
+	return n
+}
+
+// dnsNames maps the names in the records (owner names if set and names in the data) from the NNS
+// domain of the contract back to the DNS zone, so responses stay inside the queried zone.
+func (n NNS) dnsNames(nnsContract *contract.Contract, rrs []dns.RR, owners bool) {
+	name := func(s string) string {
+		return nnsContract.DNSName(s, n.dnsDomain)
+	}
+
+	for _, rr := range rrs {
+		if owners {
+			rr.Header().Name = name(rr.Header().Name)
+		}
+		switch rec := rr.(type) {
+		case *dns.CNAME:
+			rec.Target = name(rec.Target)
+		case *dns.NS:
+			rec.Ns = name(rec.Ns)
+		case *dns.MX:
+			rec.Mx = name(rec.Mx)
+		case *dns.SRV:
+			rec.Target = name(rec.Target)
+		case *dns.PTR:
+			rec.Ptr = name(rec.Ptr)
+		case *dns.SOA:
+			rec.Ns = name(rec.Ns)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package nns
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteTable(t *testing.T) {
+	regexRule, err := newRegexRewriteRule(`(\w+)\.tenants\.example\.org`, "${1}.containers")
+	require.NoError(t, err)
+	table := rewriteTable{
+		newRewriteRule("containers.example.org.", "containers."),
+		regexRule,
+		newRewriteRule("example.org", "neofs"),
+	}
+
+	for _, tc := range []struct {
+		name, zone, domain string
+		ok                 bool
+	}{
+		{name: "a.containers.example.org.", zone: "containers.example.org", domain: "containers", ok: true},
+		{name: "Containers.Example.org.", zone: "containers.example.org", domain: "containers", ok: true},
+		{name: "a.b.tenant1.tenants.example.org.", zone: "tenant1.tenants.example.org", domain: "tenant1.containers", ok: true},
+		{name: "tenants.example.org.", zone: "example.org", domain: "neofs", ok: true},
+		{name: "a.example.org.", zone: "example.org", domain: "neofs", ok: true},
+		{name: "example.com.", ok: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			zone, domain, ok := table.match(tc.name)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.zone, zone)
+			require.Equal(t, tc.domain, domain)
+		})
+	}
+
+	_, err = newRegexRewriteRule("(", "containers")
+	require.Error(t, err)
+}
+
+func TestDNSNames(t *testing.T) {
+	n := NNS{}
+	n.setDNSDomain("containers.example.org")
+	nnsContract := (&contract.Contract{}).WithDomain("containers")
+
+	rrs := []dns.RR{
+		test.SOA("containers. 3600 IN SOA ns.containers. admin.containers. 10 3600 600 86400 60"),
+		test.CNAME("a.containers. 60 IN CNAME b.containers."),
+		test.CNAME("c.containers. 60 IN CNAME example.com."),
+		test.MX("containers. 60 IN MX 10 mx.containers."),
+	}
+	n.dnsNames(nnsContract, rrs, true)
+
+	require.Equal(t, "containers.example.org.", rrs[0].Header().Name)
+	require.Equal(t, "ns.containers.example.org.", rrs[0].(*dns.SOA).Ns)
+	require.Equal(t, "a.containers.example.org.", rrs[1].Header().Name)
+	require.Equal(t, "b.containers.example.org.", rrs[1].(*dns.CNAME).Target)
+	require.Equal(t, "example.com.", rrs[2].(*dns.CNAME).Target)
+	require.Equal(t, "mx.containers.example.org.", rrs[3].(*dns.MX).Mx)
+}
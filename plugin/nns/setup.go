@@ -2,15 +2,28 @@ package nns
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"math"
+	"net"
 	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/dnssec"
 	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/coredns/coredns/plugin/pkg/fall"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/miekg/dns"
 	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neo-go/pkg/wallet"
 )
 
 const pluginName = "nns"
@@ -19,53 +32,577 @@ func init() {
 	plugin.Register(pluginName, setup)
 }
 
+// config is a parsed plugin configuration.
+type config struct {
+	contracts []*contract.Params
+
+	fall fall.F
+
+	ttl    uint32
+	ttlSet bool
+
+	cache    bool
+	cacheTTL time.Duration
+	cacheCap int
+
+	journal     bool
+	journalSize int
+
+	merge mergePolicy
+	// priorities of the contracts in the order of appearance.
+	priorities []int
+
+	denial denialMode
+	keys   []*dnssec.DNSKEY
+
+	// account signs update transactions, tsig are the secrets of the keys allowed to make updates.
+	account *wallet.Account
+	tsig    map[string]string
+
+	reverse bool
+
+	historicCode uint16
+
+	delegation bool
+
+	snapshot         string
+	snapshotMaxStale time.Duration
+	// snapshotKey signs the snapshots, snapshotHTTP is the address of the endpoint dumping them.
+	snapshotKey  []byte
+	snapshotHTTP string
+
+	rewrites rewriteTable
+}
+
 func setup(c *caddy.Controller) error {
 	URL, err := url.Parse(c.Key)
 	if err != nil {
 		return plugin.Error(pluginName, c.Err(err.Error()))
 	}
 
-	contractParams, err := parseContractParams(c)
+	cfg, err := parse(c)
 	if err != nil {
 		return err
 	}
 
-	ctx := context.TODO()
+	// Contracts are used until the shutdown, calls in progress (e.g. zone transfer) are canceled then.
+	ctx, cancel := context.WithCancel(context.Background())
 
-	contracts := make([]*contract.Contract, len(contractParams))
-	for i, prm := range contractParams {
+	contracts := make([]*contract.Contract, len(cfg.contracts))
+	for i, prm := range cfg.contracts {
 		contracts[i], err = contract.NewContract(ctx, prm)
 		if err != nil {
+			closeContracts(contracts[:i])
+			cancel()
 			return plugin.Error(pluginName, c.Err(err.Error()))
 		}
 	}
+	c.OnShutdown(func() error {
+		cancel()
+		closeContracts(contracts)
+		return nil
+	})
 
-	// Add the Plugin to CoreDNS, so Servers can use it in their plugin chain.
-	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		nns := &NNS{
-			Next:      next,
-			Contracts: contracts,
-			Log:       clog.NewWithPlugin(pluginName),
+	stopWatch := make(chan struct{})
+	c.OnStartup(func() error {
+		watchChains(contracts, stopWatch)
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stopWatch)
+		return nil
+	})
+
+	log := clog.NewWithPlugin(pluginName)
+
+	var recCache *recordCache
+	if cfg.cache {
+		recCache = newRecordCache(cfg.cacheTTL, cfg.cacheCap)
+		var polled []*contract.Contract
+		for _, nnsContract := range contracts {
+			if nnsContract.WSEndpoint() == "" {
+				polled = append(polled, nnsContract)
+			}
+		}
+		c.OnStartup(func() error {
+			if len(polled) != 0 {
+				recCache.WatchHeight(polled, log)
+			}
+			for _, nnsContract := range contracts {
+				if nnsContract.WSEndpoint() != "" {
+					recCache.WatchNotifications(nnsContract, log)
+				}
+			}
+			return nil
+		})
+		c.OnShutdown(recCache.Stop)
+	}
+
+	n := &NNS{
+		Contracts:    contracts,
+		Log:          log,
+		Fall:         cfg.fall,
+		Upstream:     upstream.New(),
+		cache:        recCache,
+		ttl:          cfg.ttl,
+		ttlOverride:  cfg.ttlSet,
+		merge:        cfg.merge,
+		priorities:   cfg.priorities,
+		denial:       cfg.denial,
+		keys:         cfg.keys,
+		historicCode: cfg.historicCode,
+		delegation:   cfg.delegation,
+		rewrites:     cfg.rewrites,
+	}
+	n.setDNSDomain(URL.Hostname())
+
+	if cfg.account != nil {
+		n.update = newUpdater(cfg.account)
+		srvConfig := dnsserver.GetConfig(c)
+		if srvConfig.TsigSecret == nil {
+			srvConfig.TsigSecret = make(map[string]string, len(cfg.tsig))
+		}
+		for name, secret := range cfg.tsig {
+			n.update.keys[name] = struct{}{}
+			srvConfig.TsigSecret[name] = secret
+		}
+	}
+
+	// The zone is transferred once on every new block for the journal, the reverse index and the snapshots.
+	var (
+		watchers  []*zoneWatcher
+		transfers *zoneWatcher
+	)
+	zoneWatch := func() *zoneWatcher {
+		if transfers == nil {
+			transfers = newZoneWatcher(contracts, func() ([]dns.RR, error) {
+				return n.zoneTransfers(n.zone())
+			}, log)
+			watchers = append(watchers, transfers)
+		}
+		return transfers
+	}
+
+	if cfg.journal {
+		n.journal = newZoneJournal(cfg.journalSize)
+		var t *transfer.Transfer
+		c.OnStartup(func() error {
+			if h := dnsserver.GetConfig(c).Handler("transfer"); h != nil {
+				t = h.(*transfer.Transfer)
+			}
+			return nil
+		})
+		zoneWatch().Subscribe(func(records []dns.RR, heights []uint32) {
+			if !n.journal.Update(records, heights) {
+				return
+			}
+			serial, _ := n.journal.Serial()
+			log.Infof("Zone changed, serial is %d", serial)
+			if t == nil {
+				return
+			}
+			if err := t.Notify(n.zone()); err != nil {
+				log.Warningf("Failed sending notifies: %s", err)
+			}
+		})
+	}
+
+	if cfg.reverse {
+		n.reverse = newReverseIndex()
+		update := func(records []dns.RR, _ []uint32) {
+			n.reverse.Update(records)
+			log.Debugf("Reverse index has %d addresses", n.reverse.Len())
+		}
+		if isReverseZone(n.zone()) {
+			// The index is built from the zone of the NNS domain, not the served one.
+			w := newZoneWatcher(contracts, n.reverseRecords, log)
+			w.Subscribe(update)
+			watchers = append(watchers, w)
+		} else {
+			zoneWatch().Subscribe(update)
 		}
-		nns.setDNSDomain(URL.Hostname())
+	}
+
+	if cfg.snapshot != "" {
+		n.snapshot = newSnapshot(cfg.snapshot, cfg.snapshotMaxStale, cfg.snapshotKey)
+		c.OnStartup(func() error {
+			if err := n.snapshot.Load(n.zone(), n.Upstream); err != nil {
+				log.Warningf("couldn't load zone snapshot from '%s': %s", cfg.snapshot, err)
+			}
+			return nil
+		})
+		zoneWatch().Subscribe(func(records []dns.RR, heights []uint32) {
+			if err := n.snapshot.Dump(n.zone(), records, heights, n.Upstream); err != nil {
+				log.Warningf("couldn't dump zone snapshot to '%s': %s", cfg.snapshot, err.Error())
+			}
+		})
+	}
+
+	if cfg.snapshotHTTP != "" {
+		srv := &snapshotServer{addr: cfg.snapshotHTTP, origin: n.zone(), key: cfg.snapshotKey}
+		zoneWatch().Subscribe(func(records []dns.RR, heights []uint32) {
+			if err := srv.Update(records, heights); err != nil {
+				log.Warningf("couldn't update zone snapshot: %s", err.Error())
+			}
+		})
+		c.OnStartup(srv.Startup)
+		c.OnShutdown(srv.Shutdown)
+	}
+
+	for _, w := range watchers {
+		c.OnStartup(w.Start)
+		c.OnShutdown(w.Stop)
+	}
 
-		return *nns
+	// Add the Plugin to CoreDNS, so Servers can use it in their plugin chain.
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		n.Next = next
+		return *n
 	})
 
 	return nil
 }
 
-func parseContractParams(c *caddy.Controller) ([]*contract.Params, error) {
-	var result []*contract.Params
+func parse(c *caddy.Controller) (*config, error) {
+	cfg := &config{}
 	for c.Next() {
 		prm, err := parseContractParam(c.RemainingArgs())
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, prm)
+		cfg.contracts = append(cfg.contracts, prm)
+		cfg.priorities = append(cfg.priorities, 0)
+
+		for c.NextBlock() {
+			if err = parseOption(c, cfg, prm); err != nil {
+				return nil, plugin.Error(pluginName, err)
+			}
+		}
+	}
+
+	if len(cfg.keys) != 0 && cfg.denial == denialNone {
+		return nil, plugin.Error(pluginName, fmt.Errorf("keys are used only with dnssec enabled"))
+	}
+
+	if (cfg.account == nil) != (len(cfg.tsig) == 0) {
+		return nil, plugin.Error(pluginName, fmt.Errorf("updates require both wallet and tsig keys"))
+	}
+
+	if (cfg.snapshot != "" || cfg.snapshotHTTP != "") != (cfg.snapshotKey != nil) {
+		return nil, plugin.Error(pluginName, fmt.Errorf("snapshots require snapshot_key and either snapshot or snapshot_http"))
+	}
+
+	for _, prm := range cfg.contracts {
+		if prm.WSEndpoint != "" && !cfg.cache {
+			return nil, plugin.Error(pluginName, fmt.Errorf("websocket notifications are used only with cache enabled"))
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseOption(c *caddy.Controller, cfg *config, prm *contract.Params) error {
+	switch c.Val() {
+	case "fallthrough":
+		cfg.fall.SetZonesFromArgs(c.RemainingArgs())
+	case "ttl":
+		// ttl SECONDS
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		ttl, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid ttl: %w", err)
+		}
+		if ttl < 0 || ttl > math.MaxInt32 {
+			return fmt.Errorf("ttl must be in range [0, %d]: %d", math.MaxInt32, ttl)
+		}
+		cfg.ttl = uint32(ttl)
+		cfg.ttlSet = true
+	case "websocket":
+		// websocket ENDPOINT
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		if URL, err := url.Parse(args[0]); err != nil {
+			return fmt.Errorf("couldn't parse websocket endpoint: %w", err)
+		} else if URL.Scheme != "ws" && URL.Scheme != "wss" {
+			return fmt.Errorf("invalid websocket endpoint: %s", args[0])
+		}
+		prm.WSEndpoint = args[0]
+	case "endpoints":
+		// endpoints ENDPOINT...
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for _, endpoint := range args {
+			if err := checkEndpoint(endpoint); err != nil {
+				return err
+			}
+		}
+		prm.Endpoints = append(prm.Endpoints, args...)
+	case "max_fails":
+		// max_fails INTEGER
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid max_fails: %w", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("max_fails can't be negative: %d", n)
+		}
+		prm.MaxFails = uint32(n)
+	case "health_check":
+		// health_check DURATION
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid health_check: %w", err)
+		}
+		if dur < 0 {
+			return fmt.Errorf("health_check can't be negative: %s", dur)
+		}
+		prm.HealthCheck = dur
+	case "timeout":
+		// timeout DURATION
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		// Requests to the node always time out, zero timeout means the default one of the RPC client.
+		if dur <= 0 {
+			return fmt.Errorf("timeout must be positive: %s", dur)
+		}
+		prm.Timeout = dur
+	case "cache":
+		// cache [TTL] [CAPACITY]
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return c.ArgErr()
+		}
+		cfg.cache = true
+		cfg.cacheTTL = defaultCacheTTL
+		cfg.cacheCap = defaultCacheCap
+		if len(args) > 0 {
+			ttl, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid cache ttl: %w", err)
+			}
+			if ttl <= 0 {
+				return fmt.Errorf("cache ttl can not be zero or negative: %d", ttl)
+			}
+			cfg.cacheTTL = time.Duration(ttl) * time.Second
+		}
+		if len(args) > 1 {
+			capacity, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid cache capacity: %w", err)
+			}
+			if capacity <= 0 {
+				return fmt.Errorf("cache capacity can not be zero or negative: %d", capacity)
+			}
+			cfg.cacheCap = capacity
+		}
+	case "merge":
+		// merge first|last|union|priority
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		policy, err := parseMergePolicy(args[0])
+		if err != nil {
+			return err
+		}
+		cfg.merge = policy
+	case "priority":
+		// priority INTEGER
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		priority, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid priority: %w", err)
+		}
+		cfg.priorities[len(cfg.priorities)-1] = priority
+	case "dnssec":
+		// dnssec [nsec|nsec3]
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return c.ArgErr()
+		}
+		cfg.denial = denialNSEC
+		if len(args) == 1 {
+			mode, err := parseDenialMode(args[0])
+			if err != nil {
+				return err
+			}
+			cfg.denial = mode
+		}
+	case "key":
+		// key file KEY...
+		args := c.RemainingArgs()
+		if len(args) < 2 || args[0] != "file" {
+			return c.ArgErr()
+		}
+		keys, err := parseKeys(dnsserver.GetConfig(c).Root, args[1:])
+		if err != nil {
+			return err
+		}
+		cfg.keys = append(cfg.keys, keys...)
+	case "ixfr":
+		// ixfr [SIZE]
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return c.ArgErr()
+		}
+		cfg.journal = true
+		cfg.journalSize = defaultJournalSize
+		if len(args) == 1 {
+			size, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid ixfr journal size: %w", err)
+			}
+			if size <= 0 {
+				return fmt.Errorf("ixfr journal size can not be zero or negative: %d", size)
+			}
+			cfg.journalSize = size
+		}
+	case "reverse":
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+		cfg.reverse = true
+	case "delegation":
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+		cfg.delegation = true
+	case "snapshot":
+		// snapshot PATH [MAX_STALENESS]
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		cfg.snapshot = args[0]
+		if !filepath.IsAbs(cfg.snapshot) && dnsserver.GetConfig(c).Root != "" {
+			cfg.snapshot = filepath.Join(dnsserver.GetConfig(c).Root, cfg.snapshot)
+		}
+		if len(args) == 2 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid snapshot max staleness: %w", err)
+			}
+			if dur <= 0 {
+				return fmt.Errorf("snapshot max staleness can not be zero or negative: %s", dur)
+			}
+			cfg.snapshotMaxStale = dur
+		}
+	case "snapshot_key":
+		// snapshot_key SECRET
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		key, err := base64.StdEncoding.DecodeString(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid snapshot key: %w", err)
+		}
+		if len(key) == 0 {
+			return fmt.Errorf("snapshot key can not be empty")
+		}
+		cfg.snapshotKey = key
+	case "snapshot_http":
+		// snapshot_http [ADDRESS]
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return c.ArgErr()
+		}
+		cfg.snapshotHTTP = defaultSnapshotHTTP
+		if len(args) == 1 {
+			if _, _, err := net.SplitHostPort(args[0]); err != nil {
+				return fmt.Errorf("invalid snapshot_http address: %w", err)
+			}
+			cfg.snapshotHTTP = args[0]
+		}
+	case "historic":
+		// historic [EDNS0_CODE]
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return c.ArgErr()
+		}
+		cfg.historicCode = defaultHistoricCode
+		if len(args) == 1 {
+			code, err := strconv.ParseUint(args[0], 0, 16)
+			if err != nil {
+				return fmt.Errorf("invalid historic option code: %w", err)
+			}
+			if code < dns.EDNS0LOCALSTART || code > dns.EDNS0LOCALEND {
+				return fmt.Errorf("historic option code must be in range [%d, %d]: %d", dns.EDNS0LOCALSTART, dns.EDNS0LOCALEND, code)
+			}
+			cfg.historicCode = uint16(code)
+		}
+	case "map":
+		// map DNS_ZONE NNS_DOMAIN
+		// map regex DNS_ZONE_REGEX NNS_DOMAIN_TEMPLATE
+		args := c.RemainingArgs()
+		switch {
+		case len(args) == 2:
+			cfg.rewrites = append(cfg.rewrites, newRewriteRule(args[0], args[1]))
+		case len(args) == 3 && args[0] == "regex":
+			rule, err := newRegexRewriteRule(args[1], args[2])
+			if err != nil {
+				return err
+			}
+			cfg.rewrites = append(cfg.rewrites, rule)
+		default:
+			return c.ArgErr()
+		}
+	case "wallet":
+		// wallet PATH PASSWORD [ADDRESS]
+		args := c.RemainingArgs()
+		if len(args) < 2 || len(args) > 3 {
+			return c.ArgErr()
+		}
+		if len(args) == 2 {
+			args = append(args, "")
+		}
+		acc, err := parseWallet(args[0], args[1], args[2])
+		if err != nil {
+			return err
+		}
+		cfg.account = acc
+	case "tsig":
+		// tsig NAME SECRET
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		if _, err := base64.StdEncoding.DecodeString(args[1]); err != nil {
+			return fmt.Errorf("invalid tsig secret: %w", err)
+		}
+		if cfg.tsig == nil {
+			cfg.tsig = make(map[string]string)
+		}
+		cfg.tsig[strings.ToLower(dns.Fqdn(args[0]))] = args[1]
+	default:
+		return c.Errf("unknown property '%s'", c.Val())
 	}
 
-	return result, nil
+	return nil
 }
 
 func parseContractParam(args []string) (*contract.Params, error) {
@@ -73,11 +610,14 @@ func parseContractParam(args []string) (*contract.Params, error) {
 		return nil, plugin.Error(pluginName, fmt.Errorf("support the following args template: 'NEO_CHAIN_ENDPOINT CONTRACT_ADDRESS [NNS_DOMAIN]'"))
 	}
 
-	prm := &contract.Params{Endpoint: args[0]}
-	if URL, err := url.Parse(prm.Endpoint); err != nil {
-		return nil, plugin.Error(pluginName, fmt.Errorf("couldn't parse endpoint: %w", err))
-	} else if URL.Scheme == "" || URL.Port() == "" {
-		return nil, plugin.Error(pluginName, fmt.Errorf("invalid endpoint: %s", prm.Endpoint))
+	if err := checkEndpoint(args[0]); err != nil {
+		return nil, plugin.Error(pluginName, err)
+	}
+	prm := &contract.Params{
+		Endpoints:   []string{args[0]},
+		MaxFails:    contract.DefaultMaxFails,
+		HealthCheck: contract.DefaultHealthCheck,
+		Timeout:     contract.DefaultTimeout,
 	}
 
 	hexStr := args[1]
@@ -95,3 +635,18 @@ func parseContractParam(args []string) (*contract.Params, error) {
 
 	return prm, nil
 }
+
+func closeContracts(contracts []*contract.Contract) {
+	for _, nnsContract := range contracts {
+		nnsContract.Close()
+	}
+}
+
+func checkEndpoint(endpoint string) error {
+	if URL, err := url.Parse(endpoint); err != nil {
+		return fmt.Errorf("couldn't parse endpoint: %w", err)
+	} else if URL.Scheme == "" || URL.Port() == "" {
+		return fmt.Errorf("invalid endpoint: %s", endpoint)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/nns/contract"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -41,7 +42,7 @@ func TestParseArgs(t *testing.T) {
 		{args: "http://localhost:30333 8b48999931c0607a78e8cb7ed773c572666f2637 domain third", valid: false},
 	} {
 		c := caddy.NewTestController("dns", "nns "+tc.args)
-		_, err := parseContractParams(c)
+		_, err := parse(c)
 		if tc.valid {
 			require.NoError(t, err)
 		} else {
@@ -50,6 +51,167 @@ func TestParseArgs(t *testing.T) {
 	}
 }
 
+func TestParseOptions(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		valid    bool
+		cache    bool
+		cacheTTL time.Duration
+		cacheCap int
+	}{
+		{input: "nns http://localhost:30333 -", valid: true},
+		{input: "nns http://localhost:30333 - {\n cache\n}", valid: true, cache: true, cacheTTL: defaultCacheTTL, cacheCap: defaultCacheCap},
+		{input: "nns http://localhost:30333 - {\n cache 30\n}", valid: true, cache: true, cacheTTL: 30 * time.Second, cacheCap: defaultCacheCap},
+		{input: "nns http://localhost:30333 - {\n cache 30 100\n}", valid: true, cache: true, cacheTTL: 30 * time.Second, cacheCap: 100},
+		{input: "nns http://localhost:30333 - {\n cache 0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n cache 30 -1\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n cache 30 100 1\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n unknown\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n cache\n websocket ws://localhost:30333/ws\n}", valid: true, cache: true, cacheTTL: defaultCacheTTL, cacheCap: defaultCacheCap},
+		{input: "nns http://localhost:30333 - {\n websocket ws://localhost:30333/ws\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n cache\n websocket http://localhost:30333\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n endpoints http://localhost:30334 http://localhost:30335\n max_fails 3\n health_check 1s\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n endpoints\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n endpoints localhost:30334\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n max_fails -1\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n health_check -1s\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n max_fails 3 4\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n health_check 1s 2s\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n health_check\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n ixfr\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n ixfr 10\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n ixfr 0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n ixfr 10 20\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n merge union\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n merge unknown\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n priority 10\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n priority high\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n dnssec\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n dnssec nsec3\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n dnssec nsec5\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n key file\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n key Kexample.org\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n reverse\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n reverse all\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n delegation\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n timeout 500ms\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n timeout 0s\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n timeout -1s\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n timeout\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot /var/lib/coredns/neofs.json\n snapshot_key c2VjcmV0\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n snapshot neofs.json 24h\n snapshot_key c2VjcmV0\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n snapshot neofs.json -1h\n snapshot_key c2VjcmV0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot neofs.json\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot_key c2VjcmV0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot neofs.json\n snapshot_key not-base64!\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot_http :8053\n snapshot_key c2VjcmV0\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n snapshot_http localhost\n snapshot_key c2VjcmV0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot_http\n snapshot_key c2VjcmV0\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n snapshot_http :8053 :8054\n snapshot_key c2VjcmV0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n snapshot_http :8053\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n delegation on\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n historic\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n historic 65100\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n historic 10\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n historic 65100 1\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n map example.org containers\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n map regex (.+)\\.example\\.org $1.containers\n}", valid: true},
+		{input: "nns http://localhost:30333 - {\n map regex ( containers\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n map example.org\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n map example.org containers extra\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n tsig key.\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n tsig key. not-base64!\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n tsig key. c2VjcmV0\n}", valid: false},
+		{input: "nns http://localhost:30333 - {\n wallet wallet.json\n}", valid: false},
+	} {
+		c := caddy.NewTestController("dns", tc.input)
+		cfg, err := parse(c)
+		if !tc.valid {
+			require.Error(t, err, tc.input)
+			continue
+		}
+		require.NoError(t, err, tc.input)
+		require.Equal(t, tc.cache, cfg.cache)
+		require.Equal(t, tc.cacheTTL, cfg.cacheTTL)
+		require.Equal(t, tc.cacheCap, cfg.cacheCap)
+	}
+}
+
+func TestParseMerge(t *testing.T) {
+	c := caddy.NewTestController("dns", "nns http://localhost:30333 -\nnns http://localhost:30334 - {\n merge priority\n priority -1\n}")
+	cfg, err := parse(c)
+	require.NoError(t, err)
+	require.Equal(t, mergePriority, cfg.merge)
+	require.Equal(t, []int{0, -1}, cfg.priorities)
+}
+
+func TestParseFallthrough(t *testing.T) {
+	c := caddy.NewTestController("dns", "nns http://localhost:30333 -")
+	cfg, err := parse(c)
+	require.NoError(t, err)
+	require.False(t, cfg.fall.Through("test.neofs."))
+
+	c = caddy.NewTestController("dns", "nns http://localhost:30333 - {\n fallthrough\n}")
+	cfg, err = parse(c)
+	require.NoError(t, err)
+	require.True(t, cfg.fall.Through("test.neofs."))
+
+	c = caddy.NewTestController("dns", "nns http://localhost:30333 - {\n fallthrough example.org\n}")
+	cfg, err = parse(c)
+	require.NoError(t, err)
+	require.False(t, cfg.fall.Through("test.neofs."))
+	require.True(t, cfg.fall.Through("test.example.org."))
+}
+
+func TestParseTTL(t *testing.T) {
+	c := caddy.NewTestController("dns", "nns http://localhost:30333 -")
+	cfg, err := parse(c)
+	require.NoError(t, err)
+	require.False(t, cfg.ttlSet)
+
+	c = caddy.NewTestController("dns", "nns http://localhost:30333 - {\n ttl 0\n}")
+	cfg, err = parse(c)
+	require.NoError(t, err)
+	require.True(t, cfg.ttlSet)
+	require.EqualValues(t, 0, cfg.ttl)
+
+	c = caddy.NewTestController("dns", "nns http://localhost:30333 - {\n ttl 300\n}")
+	cfg, err = parse(c)
+	require.NoError(t, err)
+	require.True(t, cfg.ttlSet)
+	require.EqualValues(t, 300, cfg.ttl)
+
+	for _, input := range []string{"ttl", "ttl -1", "ttl 2147483648", "ttl 1 2", "ttl abc"} {
+		c = caddy.NewTestController("dns", "nns http://localhost:30333 - {\n "+input+"\n}")
+		_, err = parse(c)
+		require.Error(t, err, input)
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	c := caddy.NewTestController("dns", `nns http://localhost:30333 - {
+		endpoints http://localhost:30334 http://localhost:30335
+		max_fails 3
+		health_check 1s
+		timeout 2s
+	}
+	nns http://localhost:30336 -`)
+	cfg, err := parse(c)
+	require.NoError(t, err)
+	require.Len(t, cfg.contracts, 2)
+
+	require.Equal(t, []string{"http://localhost:30333", "http://localhost:30334", "http://localhost:30335"}, cfg.contracts[0].Endpoints)
+	require.EqualValues(t, 3, cfg.contracts[0].MaxFails)
+	require.Equal(t, time.Second, cfg.contracts[0].HealthCheck)
+	require.Equal(t, 2*time.Second, cfg.contracts[0].Timeout)
+
+	require.Equal(t, []string{"http://localhost:30336"}, cfg.contracts[1].Endpoints)
+	require.EqualValues(t, contract.DefaultMaxFails, cfg.contracts[1].MaxFails)
+	require.Equal(t, contract.DefaultHealthCheck, cfg.contracts[1].HealthCheck)
+	require.Equal(t, contract.DefaultTimeout, cfg.contracts[1].Timeout)
+}
+
 func createDockerContainer(ctx context.Context, t *testing.T, image string) testcontainers.Container {
 	req := testcontainers.ContainerRequest{
 		Image:       image,
@@ -0,0 +1,327 @@
+package nns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/reuseport"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// snapshotVersion is the version of the snapshot file format.
+const snapshotVersion = 1
+
+// snapshotFile is the zone snapshot stored on disk.
+type snapshotFile struct {
+	Version int       `json:"version"`
+	Zone    string    `json:"zone"`
+	Created time.Time `json:"created"`
+	// Heights are the block counts of the chains of the contracts at the moment of dump.
+	Heights []uint32 `json:"heights"`
+	// Records are the zone records in presentation format, the SOA is the first one.
+	Records []string `json:"records"`
+	// Signature is the hex-encoded HMAC-SHA256 of the other fields.
+	Signature string `json:"signature"`
+}
+
+// snapshot is the local copy of the zone served when the contracts are unavailable.
+type snapshot struct {
+	path     string
+	maxStale time.Duration
+	key      []byte
+
+	mtx     sync.RWMutex
+	zone    *file.Zone
+	created time.Time
+	records []string
+}
+
+func newSnapshot(path string, maxStale time.Duration, key []byte) *snapshot {
+	return &snapshot{
+		path:     path,
+		maxStale: maxStale,
+		key:      key,
+	}
+}
+
+// newSnapshotFile forms the snapshot of the zone records (as returned by zone transfer) signed with the key.
+func newSnapshotFile(origin string, axfr []dns.RR, heights []uint32, created time.Time, key []byte) (*snapshotFile, error) {
+	if len(axfr) < 2 {
+		return nil, fmt.Errorf("zone '%s' is empty", origin)
+	}
+
+	// The trailing SOA of the transfer isn't stored.
+	records := make([]string, 0, len(axfr)-1)
+	for _, rr := range axfr[:len(axfr)-1] {
+		records = append(records, rr.String())
+	}
+
+	f := &snapshotFile{
+		Version: snapshotVersion,
+		Zone:    origin,
+		Created: created,
+		Heights: heights,
+		Records: records,
+	}
+	sig, err := f.sign(key)
+	if err != nil {
+		return nil, err
+	}
+	f.Signature = hex.EncodeToString(sig)
+	return f, nil
+}
+
+// sign returns the signature of the snapshot contents.
+func (f *snapshotFile) sign(key []byte) ([]byte, error) {
+	cp := *f
+	cp.Signature = ""
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// verify checks that the snapshot is signed with the key.
+func (f *snapshotFile) verify(key []byte) error {
+	sig, err := hex.DecodeString(f.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot signature: %w", err)
+	}
+	expected, err := f.sign(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sig, expected) {
+		return errors.New("snapshot signature mismatch")
+	}
+	return nil
+}
+
+// Load reads the snapshot of the zone from the file.
+func (s *snapshot) Load(origin string, up *upstream.Upstream) error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var f snapshotFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if f.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version: %d", f.Version)
+	}
+	if err = f.verify(s.key); err != nil {
+		return err
+	}
+	if !dns.IsSubDomain(origin, f.Zone) || !dns.IsSubDomain(f.Zone, origin) {
+		return fmt.Errorf("snapshot of zone '%s' instead of '%s'", f.Zone, origin)
+	}
+
+	return s.set(origin, f.Created, f.Records, up)
+}
+
+// Dump stores the zone records (as returned by zone transfer) to the file. The file isn't rewritten
+// if the zone hasn't changed, only the served copy is considered fresh then.
+func (s *snapshot) Dump(origin string, axfr []dns.RR, heights []uint32, up *upstream.Upstream) error {
+	now := time.Now().UTC()
+	if s.unchanged(axfr) {
+		s.mtx.Lock()
+		s.created = now
+		s.mtx.Unlock()
+		return nil
+	}
+
+	f, err := newSnapshotFile(origin, axfr, heights, now, s.key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	// The file is replaced atomically, so it's never read half-written.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return s.set(origin, now, f.Records, up)
+}
+
+// set replaces the served zone.
+func (s *snapshot) set(origin string, created time.Time, records []string, up *upstream.Upstream) error {
+	z := file.NewZone(origin, s.path)
+	z.Upstream = up
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot record '%s': %w", record, err)
+		}
+		if err = z.Insert(rr); err != nil {
+			return err
+		}
+	}
+	if z.Apex.SOA == nil {
+		return fmt.Errorf("snapshot of zone '%s' has no soa", origin)
+	}
+
+	s.mtx.Lock()
+	s.zone = z
+	s.created = created
+	s.records = records
+	s.mtx.Unlock()
+	return nil
+}
+
+// Lookup resolves the request from the snapshot. False is returned if there is no snapshot
+// or it's older than the max staleness.
+func (s *snapshot) Lookup(ctx context.Context, state request.Request) (*response, bool) {
+	s.mtx.RLock()
+	z, created := s.zone, s.created
+	s.mtx.RUnlock()
+
+	if z == nil || s.maxStale != 0 && time.Since(created) > s.maxStale {
+		return nil, false
+	}
+
+	answer, ns, extra, result := z.Lookup(ctx, state, state.Name())
+	res := &response{Answer: answer, Ns: ns, Extra: extra, Rcode: dns.RcodeSuccess}
+	switch result {
+	case file.NameError:
+		res.Rcode = dns.RcodeNameError
+	case file.Delegation:
+		res.delegation = true
+	case file.ServerFailure:
+		return nil, false
+	}
+	return res, true
+}
+
+// unchanged checks whether the records are the same as the served ones.
+func (s *snapshot) unchanged(axfr []dns.RR) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if len(axfr) == 0 || len(s.records) != len(axfr)-1 {
+		return false
+	}
+	for i, record := range s.records {
+		if axfr[i].String() != record {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshotPath is the path of the debug endpoint the snapshot is served at.
+const snapshotPath = "/nns/snapshot"
+
+// defaultSnapshotHTTP is the address of the snapshot endpoint, it's reachable only locally.
+const defaultSnapshotHTTP = "localhost:8053"
+
+// snapshotServer is the debug HTTP endpoint that serves the snapshot of the zone as it's transferred
+// on the last block, so it can be copied to the servers without reachable nodes.
+type snapshotServer struct {
+	addr   string
+	origin string
+	key    []byte
+
+	mtx sync.RWMutex
+	// data is the last signed snapshot file, nil until the zone is transferred.
+	data []byte
+
+	ln net.Listener
+}
+
+// Update replaces the served snapshot with the zone records (as returned by zone transfer).
+func (s *snapshotServer) Update(axfr []dns.RR, heights []uint32) error {
+	f, err := newSnapshotFile(s.origin, axfr, heights, time.Now().UTC(), s.key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	s.data = data
+	s.mtx.Unlock()
+	return nil
+}
+
+// Startup starts listening for the snapshot requests.
+func (s *snapshotServer) Startup() error {
+	// Startup is called for the new plugin before Shutdown for the old one on reload, so the port is reused.
+	ln, err := reuseport.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+
+	mux := http.NewServeMux()
+	mux.Handle(snapshotPath, s)
+	go func() {
+		http.Serve(s.ln, mux)
+	}()
+	return nil
+}
+
+// Shutdown stops the endpoint.
+func (s *snapshotServer) Shutdown() error {
+	if s.ln != nil {
+		return s.ln.Close()
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler, the contracts aren't requested.
+func (s *snapshotServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mtx.RLock()
+	data := s.data
+	s.mtx.RUnlock()
+	if data == nil {
+		http.Error(w, "zone hasn't been transferred yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,107 @@
+package nns
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nns")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "neofs.json")
+
+	soa := test.SOA("neofs. 3600 IN SOA ns.neofs. admin.neofs. 10 3600 600 86400 60")
+	axfr := []dns.RR{soa, test.A("a.neofs. 60 IN A 10.0.0.1"), soa}
+
+	key := []byte("secret")
+
+	s := newSnapshot(path, 0, key)
+	require.NoError(t, s.Dump("neofs.", axfr, []uint32{100}, nil))
+
+	loaded := newSnapshot(path, time.Hour, key)
+	require.Error(t, loaded.Load("other.", nil))
+	require.Error(t, newSnapshot(path, 0, []byte("other")).Load("neofs.", nil))
+	require.NoError(t, loaded.Load("neofs.", nil))
+
+	lookup := func(s *snapshot, name string) (*response, bool) {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		return s.Lookup(context.Background(), request.Request{W: &test.ResponseWriter{}, Req: m})
+	}
+
+	res, ok := lookup(loaded, "a.neofs.")
+	require.True(t, ok)
+	require.Equal(t, dns.RcodeSuccess, res.Rcode)
+	require.Len(t, res.Answer, 1)
+	require.Equal(t, "10.0.0.1", res.Answer[0].(*dns.A).A.String())
+
+	res, ok = lookup(loaded, "b.neofs.")
+	require.True(t, ok)
+	require.Equal(t, dns.RcodeNameError, res.Rcode)
+
+	loaded.created = time.Now().Add(-2 * time.Hour)
+	_, ok = lookup(loaded, "a.neofs.")
+	require.False(t, ok)
+
+	// The file isn't rewritten if the zone hasn't changed.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, s.Dump("neofs.", axfr, []uint32{101}, nil))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	axfr = []dns.RR{soa, test.A("a.neofs. 60 IN A 10.0.0.2"), soa}
+	require.NoError(t, s.Dump("neofs.", axfr, []uint32{102}, nil))
+	require.NoError(t, newSnapshot(path, 0, key).Load("neofs.", nil))
+
+	// Modified snapshot isn't loaded.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	data = []byte(strings.Replace(string(data), "10.0.0.2", "10.0.0.3", 1))
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	require.Error(t, newSnapshot(path, 0, key).Load("neofs.", nil))
+}
+
+func TestSnapshotServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nns")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "neofs.json")
+
+	soa := test.SOA("neofs. 3600 IN SOA ns.neofs. admin.neofs. 10 3600 600 86400 60")
+	srv := &snapshotServer{origin: "neofs.", key: []byte("secret")}
+
+	// Nothing is served until the zone is transferred.
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, snapshotPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	require.NoError(t, srv.Update([]dns.RR{soa, test.A("a.neofs. 60 IN A 10.0.0.1"), soa}, []uint32{100}))
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, snapshotPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// The dumped snapshot is served by another server.
+	require.NoError(t, ioutil.WriteFile(path, rec.Body.Bytes(), 0600))
+	s := newSnapshot(path, 0, srv.key)
+	require.NoError(t, s.Load("neofs.", nil))
+	require.Equal(t, []string{soa.String(), "a.neofs.\t60\tIN\tA\t10.0.0.1"}, s.records)
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, snapshotPath, nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	require.Error(t, srv.Update([]dns.RR{soa}, []uint32{101}))
+}
@@ -0,0 +1,482 @@
+package nns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/miekg/dns"
+	"github.com/nspcc-dev/neo-go/pkg/encoding/address"
+	"github.com/nspcc-dev/neo-go/pkg/util"
+	"github.com/nspcc-dev/neo-go/pkg/wallet"
+	"github.com/nspcc-dev/neofs-contract/nns"
+)
+
+const (
+	// tsigFudge is the allowed time difference of signed update responses.
+	tsigFudge = 300
+	// updateTimeout is the time the transaction applying the update is awaited for.
+	updateTimeout = time.Minute
+	// updateRetention is the time the update result is kept for retransmitted requests.
+	updateRetention = 5 * time.Minute
+)
+
+// updater applies RFC 2136 dynamic updates to the first contract
+// with the transactions signed by the account.
+type updater struct {
+	account *wallet.Account
+	// keys are the names of TSIG keys allowed to make updates.
+	keys map[string]struct{}
+
+	mtx sync.Mutex
+	// applied are the updates by the key of the request, retransmitted requests get
+	// the result of the first one instead of sending another transaction.
+	applied map[string]*appliedUpdate
+}
+
+// appliedUpdate is the result of the update, rcode is set once done is closed.
+type appliedUpdate struct {
+	done  chan struct{}
+	rcode int
+}
+
+func newUpdater(account *wallet.Account) *updater {
+	return &updater{
+		account: account,
+		keys:    make(map[string]struct{}),
+		applied: make(map[string]*appliedUpdate),
+	}
+}
+
+// once calls apply once for all the requests with the key and returns its result.
+func (u *updater) once(key string, apply func() int) int {
+	u.mtx.Lock()
+	upd, ok := u.applied[key]
+	if !ok {
+		upd = &appliedUpdate{done: make(chan struct{})}
+		u.applied[key] = upd
+	}
+	u.mtx.Unlock()
+
+	if ok {
+		<-upd.done
+		return upd.rcode
+	}
+
+	upd.rcode = apply()
+	close(upd.done)
+	time.AfterFunc(updateRetention, func() {
+		u.mtx.Lock()
+		delete(u.applied, key)
+		u.mtx.Unlock()
+	})
+	return upd.rcode
+}
+
+// updateKey returns the key of the update request, it's the same for the retransmissions of the request.
+func updateKey(keyName string, r *dns.Msg) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s/%d", strings.ToLower(keyName), r.Id)
+	for _, rrs := range [][]dns.RR{r.Answer, r.Ns} {
+		for _, rr := range rrs {
+			b.WriteString("\n")
+			b.WriteString(rr.String())
+		}
+	}
+	return b.String()
+}
+
+// rrsetChange is the planned change of the records of the name and type.
+type rrsetChange struct {
+	name    string
+	nnsType nns.RecordType
+	current []string
+	desired []string
+}
+
+// serveUpdate handles the UPDATE message. The result of the transaction
+// applying the update is reported as the response code.
+func (n NNS) serveUpdate(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Rcode = n.applyUpdate(ctx, w, r)
+
+	if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, tsigFudge, time.Now().Unix())
+	}
+
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+func (n NNS) applyUpdate(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) int {
+	if n.update == nil {
+		return dns.RcodeNotImplemented
+	}
+
+	t := r.IsTsig()
+	if t == nil {
+		n.Log.Warningf("unsigned update from %s refused", w.RemoteAddr())
+		return dns.RcodeRefused
+	}
+	if _, ok := n.update.keys[strings.ToLower(t.Hdr.Name)]; !ok || w.TsigStatus() != nil {
+		n.Log.Warningf("update from %s with key '%s' is not authorized", w.RemoteAddr(), t.Hdr.Name)
+		return dns.RcodeNotAuth
+	}
+
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	if !strings.EqualFold(r.Question[0].Name, n.zone()) {
+		return dns.RcodeNotAuth
+	}
+
+	// Retransmitted requests wait for the result of the first one, so the update is applied once.
+	return n.update.once(updateKey(t.Hdr.Name, r), func() int {
+		if rcode := n.checkPrerequisites(r.Answer); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+
+		calls, rcode := n.planUpdate(r.Ns)
+		if rcode != dns.RcodeSuccess {
+			return rcode
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+		defer cancel()
+		txHash, err := n.Contracts[0].Invoke(ctx, n.update.account, calls)
+		if !txHash.Equals(util.Uint256{}) && n.cache != nil {
+			// The transaction can be persisted even if it isn't awaited.
+			n.cache.Invalidate()
+		}
+		if err != nil {
+			n.Log.Warningf("update of '%s' with key '%s' failed: %s", n.zone(), t.Hdr.Name, err.Error())
+			if errors.Is(err, contract.ErrFault) {
+				return dns.RcodeRefused
+			}
+			return dns.RcodeServerFailure
+		}
+		if len(calls) != 0 {
+			n.Log.Debugf("update of '%s' with key '%s' is persisted in transaction %s", n.zone(), t.Hdr.Name, txHash.StringLE())
+		}
+		return dns.RcodeSuccess
+	})
+}
+
+// checkPrerequisites checks the prerequisite section of the update (RFC 2136, section 3.2).
+func (n NNS) checkPrerequisites(prereqs []dns.RR) int {
+	expected := make(map[string]*rrsetChange)
+	var keys []string
+
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(n.zone(), hdr.Name) {
+			return dns.RcodeNotZone
+		}
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY, dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			var exists bool
+			if hdr.Rrtype == dns.TypeANY {
+				types, err := n.Contracts[0].Types(n.nnsName(hdr.Name))
+				if err != nil && !errors.Is(err, contract.ErrFault) {
+					return dns.RcodeServerFailure
+				}
+				exists = len(types) != 0
+			} else {
+				data, rcode := n.currentRecords(hdr.Name, hdr.Rrtype)
+				if rcode != dns.RcodeSuccess {
+					return rcode
+				}
+				exists = len(data) != 0
+			}
+
+			switch {
+			case hdr.Class == dns.ClassANY && !exists && hdr.Rrtype == dns.TypeANY:
+				return dns.RcodeNameError
+			case hdr.Class == dns.ClassANY && !exists:
+				return dns.RcodeNXRrset
+			case hdr.Class == dns.ClassNONE && exists && hdr.Rrtype == dns.TypeANY:
+				return dns.RcodeYXDomain
+			case hdr.Class == dns.ClassNONE && exists:
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			// RRset exists with the exact records.
+			key := recKey(strings.ToLower(hdr.Name), nns.RecordType(hdr.Rrtype))
+			set, ok := expected[key]
+			if !ok {
+				nnsType, err := toNNSType(hdr.Rrtype)
+				if err != nil {
+					return dns.RcodeFormatError
+				}
+				set = &rrsetChange{name: hdr.Name, nnsType: nnsType}
+				expected[key] = set
+				keys = append(keys, key)
+			}
+			if data := recordData(rr); !containsString(set.desired, data) {
+				set.desired = append(set.desired, data)
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for _, key := range keys {
+		set := expected[key]
+		data, rcode := n.currentRecords(set.name, uint16(set.nnsType))
+		if rcode != dns.RcodeSuccess {
+			return rcode
+		}
+		if !sameData(data, set.desired) {
+			return dns.RcodeNXRrset
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// planUpdate converts the update section (RFC 2136, section 3.4) to the contract calls.
+func (n NNS) planUpdate(updates []dns.RR) ([]contract.Call, int) {
+	changes := make(map[string]*rrsetChange)
+	var keys []string
+
+	change := func(name string, qtype uint16) (*rrsetChange, int) {
+		key := recKey(strings.ToLower(name), nns.RecordType(qtype))
+		if ch, ok := changes[key]; ok {
+			return ch, dns.RcodeSuccess
+		}
+		nnsType, err := toNNSType(qtype)
+		if err != nil {
+			return nil, dns.RcodeFormatError
+		}
+		current, rcode := n.currentRecords(name, qtype)
+		if rcode != dns.RcodeSuccess {
+			return nil, rcode
+		}
+		ch := &rrsetChange{
+			name:    n.nnsName(name),
+			nnsType: nnsType,
+			current: current,
+			desired: append([]string(nil), current...),
+		}
+		changes[key] = ch
+		keys = append(keys, key)
+		return ch, dns.RcodeSuccess
+	}
+
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(n.zone(), hdr.Name) {
+			return nil, dns.RcodeNotZone
+		}
+		if hdr.Rrtype == dns.TypeSOA {
+			// SOA is managed by the contract itself.
+			return nil, dns.RcodeRefused
+		}
+		switch hdr.Rrtype {
+		case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+			return nil, dns.RcodeFormatError
+		case dns.TypeANY:
+			if hdr.Class != dns.ClassANY {
+				return nil, dns.RcodeFormatError
+			}
+		}
+
+		switch hdr.Class {
+		case dns.ClassINET:
+			ch, rcode := change(hdr.Name, hdr.Rrtype)
+			if rcode != dns.RcodeSuccess {
+				return nil, rcode
+			}
+			if data := recordData(rr); !containsString(ch.desired, data) {
+				ch.desired = append(ch.desired, data)
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 {
+				return nil, dns.RcodeFormatError
+			}
+			qtypes := []uint16{hdr.Rrtype}
+			if hdr.Rrtype == dns.TypeANY {
+				types, err := n.Contracts[0].Types(n.nnsName(hdr.Name))
+				if err != nil && !errors.Is(err, contract.ErrFault) {
+					return nil, dns.RcodeServerFailure
+				}
+				qtypes = qtypes[:0]
+				for _, t := range types {
+					// SOA and NS records of the apex are never deleted this way.
+					if uint16(t) == dns.TypeSOA || uint16(t) == dns.TypeNS && strings.EqualFold(hdr.Name, n.zone()) {
+						continue
+					}
+					qtypes = append(qtypes, uint16(t))
+				}
+			}
+			for _, qtype := range qtypes {
+				ch, rcode := change(hdr.Name, qtype)
+				if rcode != dns.RcodeSuccess {
+					return nil, rcode
+				}
+				ch.desired = nil
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return nil, dns.RcodeFormatError
+			}
+			ch, rcode := change(hdr.Name, hdr.Rrtype)
+			if rcode != dns.RcodeSuccess {
+				return nil, rcode
+			}
+			data := recordData(rr)
+			desired := ch.desired[:0]
+			for _, d := range ch.desired {
+				if d != data {
+					desired = append(desired, d)
+				}
+			}
+			ch.desired = desired
+		default:
+			return nil, dns.RcodeFormatError
+		}
+	}
+
+	sort.Strings(keys)
+	var calls []contract.Call
+	for _, key := range keys {
+		calls = append(calls, changes[key].calls()...)
+	}
+
+	return calls, dns.RcodeSuccess
+}
+
+// calls returns the contract calls turning the current records into the desired ones.
+func (ch *rrsetChange) calls() []contract.Call {
+	switch {
+	case sameData(ch.current, ch.desired) && len(ch.current) == len(ch.desired):
+		return nil
+	case len(ch.desired) == 0:
+		return []contract.Call{contract.DeleteRecords(ch.name, ch.nnsType)}
+	case len(ch.current) == len(ch.desired):
+		var calls []contract.Call
+		for i := range ch.desired {
+			if ch.current[i] != ch.desired[i] {
+				calls = append(calls, contract.SetRecord(ch.name, ch.nnsType, i, ch.desired[i]))
+			}
+		}
+		return calls
+	case len(ch.current) < len(ch.desired) && isPrefix(ch.current, ch.desired):
+		var calls []contract.Call
+		for _, data := range ch.desired[len(ch.current):] {
+			calls = append(calls, contract.AddRecord(ch.name, ch.nnsType, data))
+		}
+		return calls
+	}
+
+	calls := []contract.Call{contract.DeleteRecords(ch.name, ch.nnsType)}
+	for _, data := range ch.desired {
+		calls = append(calls, contract.AddRecord(ch.name, ch.nnsType, data))
+	}
+	return calls
+}
+
+// currentRecords returns the data of the records stored in the first contract.
+// Names that are not registered have no records.
+func (n NNS) currentRecords(name string, qtype uint16) ([]string, int) {
+	nnsType, err := toNNSType(qtype)
+	if err != nil {
+		return nil, dns.RcodeFormatError
+	}
+	data, err := n.Contracts[0].GetRecords(n.nnsName(name), nnsType)
+	if err != nil {
+		if errors.Is(err, contract.ErrFault) {
+			return nil, dns.RcodeSuccess
+		}
+		n.Log.Warningf("couldn't get records of '%s' (type %s): %s", name, dns.Type(qtype), err.Error())
+		return nil, dns.RcodeServerFailure
+	}
+	return data, dns.RcodeSuccess
+}
+
+func (n NNS) nnsName(name string) string {
+	return strings.ToLower(n.Contracts[0].PrepareName(name, n.dnsDomain))
+}
+
+// recordData returns the record data in the form it's stored in the contract.
+func recordData(rr dns.RR) string {
+	switch rec := rr.(type) {
+	case *dns.A:
+		return rec.A.String()
+	case *dns.AAAA:
+		return rec.AAAA.String()
+	case *dns.TXT:
+		return strings.Join(rec.Txt, "")
+	case *dns.CNAME:
+		return strings.TrimSuffix(rec.Target, dot)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// sameData checks whether the lists contain the same records regardless of order.
+func sameData(a, b []string) bool {
+	for _, data := range a {
+		if !containsString(b, data) {
+			return false
+		}
+	}
+	for _, data := range b {
+		if !containsString(a, data) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrefix(prefix, list []string) bool {
+	for i := range prefix {
+		if prefix[i] != list[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseWallet opens the wallet and decrypts its account with the address
+// or the first one if the address is empty.
+func parseWallet(path, password, addr string) (*wallet.Account, error) {
+	w, err := wallet.NewWalletFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open wallet: %w", err)
+	}
+	defer w.Close()
+
+	var acc *wallet.Account
+	if addr == "" {
+		if len(w.Accounts) == 0 {
+			return nil, fmt.Errorf("wallet '%s' has no accounts", path)
+		}
+		acc = w.Accounts[0]
+	} else {
+		hash, err := address.StringToUint160(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account address: %w", err)
+		}
+		if acc = w.GetAccount(hash); acc == nil {
+			return nil, fmt.Errorf("wallet '%s' has no account %s", path, addr)
+		}
+	}
+
+	if err = acc.Decrypt(password, w.Scrypt); err != nil {
+		return nil, fmt.Errorf("couldn't decrypt account %s: %w", acc.Address, err)
+	}
+	return acc, nil
+}
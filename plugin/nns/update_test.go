@@ -0,0 +1,74 @@
+package nns
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/nspcc-dev/neofs-contract/nns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRRSetChangeCalls(t *testing.T) {
+	for _, tc := range []struct {
+		current, desired []string
+		expected         []contract.Call
+	}{
+		{current: []string{"1", "2"}, desired: []string{"2", "1"}},
+		{current: []string{"1"}, desired: nil, expected: []contract.Call{contract.DeleteRecords("a.neofs", nns.A)}},
+		{current: []string{"1", "2"}, desired: []string{"1", "3"}, expected: []contract.Call{contract.SetRecord("a.neofs", nns.A, 1, "3")}},
+		{current: []string{"1"}, desired: []string{"1", "2"}, expected: []contract.Call{contract.AddRecord("a.neofs", nns.A, "2")}},
+		{current: []string{"1", "2"}, desired: []string{"2"}, expected: []contract.Call{
+			contract.DeleteRecords("a.neofs", nns.A),
+			contract.AddRecord("a.neofs", nns.A, "2"),
+		}},
+	} {
+		ch := &rrsetChange{name: "a.neofs", nnsType: nns.A, current: tc.current, desired: tc.desired}
+		require.Equal(t, tc.expected, ch.calls(), "%v -> %v", tc.current, tc.desired)
+	}
+}
+
+func TestRecordData(t *testing.T) {
+	require.Equal(t, "10.0.0.1", recordData(test.A("a.neofs. 60 IN A 10.0.0.1")))
+	require.Equal(t, "b.neofs", recordData(test.CNAME("a.neofs. 60 IN CNAME b.neofs.")))
+	require.Equal(t, "10 mail.neofs.", recordData(test.MX("neofs. 60 IN MX 10 mail.neofs.")))
+
+	rr, err := dns.NewRR(`a.neofs. 60 IN TXT "hello"`)
+	require.NoError(t, err)
+	require.Equal(t, "hello", recordData(rr))
+}
+
+func TestUpdateOnce(t *testing.T) {
+	u := newUpdater(nil)
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.neofs.")
+	m.Insert([]dns.RR{test.A("a.example.neofs. 300 IN A 10.0.0.1")})
+	key := updateKey("Key.", m)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var applied int32
+	apply := func() int {
+		atomic.AddInt32(&applied, 1)
+		close(started)
+		<-release
+		return dns.RcodeRefused
+	}
+
+	res := make(chan int)
+	go func() { res <- u.once(key, apply) }()
+	<-started
+
+	// The retransmission waits for the result of the first request.
+	go func() { res <- u.once(updateKey("key.", m), apply) }()
+	close(release)
+	require.Equal(t, dns.RcodeRefused, <-res)
+	require.Equal(t, dns.RcodeRefused, <-res)
+	require.EqualValues(t, 1, atomic.LoadInt32(&applied))
+
+	// Other updates are applied.
+	m.Id++
+	require.Equal(t, dns.RcodeSuccess, u.once(updateKey("key.", m), func() int { return dns.RcodeSuccess }))
+}
@@ -0,0 +1,100 @@
+package nns
+
+import (
+	"time"
+
+	"github.com/coredns/coredns/plugin/nns/contract"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
+)
+
+// zoneWatcher transfers the zone once on every new block in any of the chains and passes
+// the records to all the subscribers (the journal, the reverse index and the snapshot).
+type zoneWatcher struct {
+	contracts []*contract.Contract
+	transfer  func() ([]dns.RR, error)
+	log       clog.P
+	// subscribers get the records and the chain heights they are transferred at.
+	subscribers []func([]dns.RR, []uint32)
+
+	stop chan struct{}
+}
+
+func newZoneWatcher(contracts []*contract.Contract, transfer func() ([]dns.RR, error), log clog.P) *zoneWatcher {
+	return &zoneWatcher{
+		contracts: contracts,
+		transfer:  transfer,
+		log:       log,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Subscribe adds the function called with the zone records on every new block.
+// It must be called before the watcher is started.
+func (w *zoneWatcher) Subscribe(f func([]dns.RR, []uint32)) {
+	w.subscribers = append(w.subscribers, f)
+}
+
+// Start starts watching the chains, call Stop to finish watching.
+func (w *zoneWatcher) Start() error {
+	watchBlocks(w.contracts, w.stop, w.log, func() {
+		// The heights are got before the transfer, so the zone state is at least at them.
+		heights := chainHeights(w.contracts)
+		records, err := w.transfer()
+		if err != nil {
+			w.log.Warningf("couldn't transfer zone: %s", err.Error())
+			return
+		}
+		for _, f := range w.subscribers {
+			f(records, heights)
+		}
+	})
+	return nil
+}
+
+// Stop stops watching the chains.
+func (w *zoneWatcher) Stop() error {
+	close(w.stop)
+	return nil
+}
+
+// chainHeights returns the block counts of the chains of the contracts, zero if it's unknown.
+func chainHeights(contracts []*contract.Contract) []uint32 {
+	heights := make([]uint32, len(contracts))
+	for i, nnsContract := range contracts {
+		heights[i], _ = nnsContract.BlockCount()
+	}
+	return heights
+}
+
+// watchBlocks calls onBlock every time a new block is persisted in any of the chains until stop is closed.
+func watchBlocks(contracts []*contract.Contract, stop <-chan struct{}, log clog.P, onBlock func()) {
+	heights := make([]uint32, len(contracts))
+	tick := time.NewTicker(heightPollInterval)
+
+	go func() {
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				changed := false
+				for i, nnsContract := range contracts {
+					height, err := nnsContract.BlockCount()
+					if err != nil {
+						log.Warningf("get block count in contract '%s': %s", nnsContract.Hash().StringLE(), err.Error())
+						continue
+					}
+					if height != heights[i] {
+						heights[i] = height
+						changed = true
+					}
+				}
+				if changed {
+					onBlock()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
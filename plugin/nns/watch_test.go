@@ -0,0 +1,46 @@
+package nns
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneWatcher(t *testing.T) {
+	n := newStaticNNS()
+
+	var transfers int32
+	w := newZoneWatcher(n.Contracts, func() ([]dns.RR, error) {
+		atomic.AddInt32(&transfers, 1)
+		return n.zoneTransfers(testZone + ".")
+	}, clog.NewWithPlugin(pluginName))
+
+	// All the subscribers get the records of a single transfer.
+	type update struct {
+		records []dns.RR
+		heights []uint32
+	}
+	got := make(chan update, 2)
+	for i := 0; i < 2; i++ {
+		w.Subscribe(func(records []dns.RR, heights []uint32) {
+			got <- update{records: records, heights: heights}
+		})
+	}
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case upd := <-got:
+			require.Len(t, upd.records, 2)
+			require.Equal(t, []uint32{1}, upd.heights)
+		case <-time.After(5 * heightPollInterval):
+			t.Fatal("zone isn't transferred")
+		}
+	}
+	require.EqualValues(t, 1, atomic.LoadInt32(&transfers))
+}